@@ -0,0 +1,125 @@
+package goblin
+
+import (
+	"errors"
+	"fmt"
+	"github.com/hashicorp/memberlist"
+	"go.uber.org/zap"
+	"net"
+	"strconv"
+	"time"
+)
+
+// interfaceIP returns the first IPv4 address of a network interface, or its first global IPv6 address
+func interfaceIP(name string) (string, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return "", err
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return "", err
+	}
+
+	var ipv6 net.IP
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		if ip4 := ipNet.IP.To4(); ip4 != nil {
+			return ip4.String(), nil
+		}
+		if ipv6 == nil && ipNet.IP.IsGlobalUnicast() {
+			ipv6 = ipNet.IP
+		}
+	}
+	if ipv6 != nil {
+		return ipv6.String(), nil
+	}
+	return "", fmt.Errorf("no address found for network interface %s", name)
+}
+
+// parseAdvertiseAddr accepts "ip" or "ip:port", the port defaults to defaultPort
+func parseAdvertiseAddr(addr string, defaultPort int) (string, int, error) {
+	if net.ParseIP(addr) != nil {
+		return addr, defaultPort, nil
+	}
+
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil || net.ParseIP(host) == nil {
+		return "", 0, errors.New("invalid AdvertiseAddr")
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port <= 0 || port > 65535 {
+		return "", 0, errors.New("invalid AdvertiseAddr")
+	}
+	return host, port, nil
+}
+
+func validateAddressConfig(conf ServerConfig) error {
+	if conf.BindAddr != "" && net.ParseIP(conf.BindAddr) == nil {
+		return errors.New("invalid BindAddr")
+	}
+	if conf.AdvertiseAddr != "" && conf.AdvertiseInterface != "" {
+		return errors.New("only one of AdvertiseAddr and AdvertiseInterface can be set")
+	}
+	if conf.AdvertiseAddr != "" {
+		if _, _, err := parseAdvertiseAddr(conf.AdvertiseAddr, 0); err != nil {
+			return err
+		}
+	}
+	if conf.AdvertiseGRPCAddr != "" {
+		if _, _, err := net.SplitHostPort(conf.AdvertiseGRPCAddr); err != nil {
+			return errors.New("invalid AdvertiseGRPCAddr")
+		}
+	}
+	return nil
+}
+
+// configureMemberlistAddrs is applied before WithServerMemberlistConfig, so it can still be overridden.
+// The advertise port is always set since memberlist uses it (default 7946) whenever the advertise address is set
+func configureMemberlistAddrs(conf ServerConfig, mconf *memberlist.Config, portDiff uint16) error {
+	mconf.BindPort = int(conf.GRPCPort + portDiff)
+	if conf.MemberlistPort != 0 {
+		mconf.BindPort = int(conf.MemberlistPort)
+	}
+	mconf.AdvertisePort = mconf.BindPort
+
+	if conf.BindAddr != "" {
+		mconf.BindAddr = conf.BindAddr
+	}
+
+	if conf.AdvertiseInterface != "" {
+		ip, err := interfaceIP(conf.AdvertiseInterface)
+		if err != nil {
+			return err
+		}
+		mconf.AdvertiseAddr = ip
+	}
+
+	if conf.AdvertiseAddr != "" {
+		ip, port, err := parseAdvertiseAddr(conf.AdvertiseAddr, mconf.BindPort)
+		if err != nil {
+			return err
+		}
+		mconf.AdvertiseAddr = ip
+		mconf.AdvertisePort = port
+	}
+	return nil
+}
+
+// initGRPCAddr defaults to the memberlist advertise IP with GRPCPort, it is only known after
+// creating memberlist, then the node metadata is updated
+func initGRPCAddr(conf ServerConfig, m *memberlist.Memberlist, d *delegate, logger *zap.Logger) string {
+	if addr := d.getGRPCAddr(); addr != "" {
+		return addr
+	}
+
+	addr := net.JoinHostPort(m.LocalNode().Addr.String(), strconv.Itoa(int(conf.GRPCPort)))
+	d.setGRPCAddr(addr)
+	if err := m.UpdateNode(time.Second); err != nil {
+		logger.Warn("UpdateNode", zap.Error(err))
+	}
+	return addr
+}
@@ -0,0 +1,152 @@
+package goblin
+
+import (
+	"errors"
+	"github.com/hashicorp/memberlist"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestInterfaceIP(t *testing.T) {
+	ip, err := interfaceIP("lo")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "127.0.0.1", ip)
+
+	_, err = interfaceIP("not-found-interface")
+	assert.Error(t, err)
+}
+
+func TestParseAdvertiseAddr(t *testing.T) {
+	ip, port, err := parseAdvertiseAddr("10.0.0.1", 7946)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "10.0.0.1", ip)
+	assert.Equal(t, 7946, port)
+
+	ip, port, err = parseAdvertiseAddr("10.0.0.1:31000", 7946)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "10.0.0.1", ip)
+	assert.Equal(t, 31000, port)
+
+	ip, port, err = parseAdvertiseAddr("[fd00::1]:31000", 7946)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "fd00::1", ip)
+	assert.Equal(t, 31000, port)
+
+	ip, port, err = parseAdvertiseAddr("fd00::1", 7946)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "fd00::1", ip)
+	assert.Equal(t, 7946, port)
+
+	_, _, err = parseAdvertiseAddr("some-host:31000", 7946)
+	assert.Equal(t, errors.New("invalid AdvertiseAddr"), err)
+
+	_, _, err = parseAdvertiseAddr("10.0.0.1:abc", 7946)
+	assert.Equal(t, errors.New("invalid AdvertiseAddr"), err)
+
+	_, _, err = parseAdvertiseAddr("10.0.0.1:70000", 7946)
+	assert.Equal(t, errors.New("invalid AdvertiseAddr"), err)
+}
+
+func TestValidateAddressConfig(t *testing.T) {
+	table := []struct {
+		name string
+		conf ServerConfig
+		err  error
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name: "normal",
+			conf: ServerConfig{
+				BindAddr:          "0.0.0.0",
+				AdvertiseAddr:     "10.0.0.1:31000",
+				AdvertiseGRPCAddr: "public-host:31001",
+			},
+		},
+		{
+			name: "invalid-bind-addr",
+			conf: ServerConfig{BindAddr: "some-host"},
+			err:  errors.New("invalid BindAddr"),
+		},
+		{
+			name: "invalid-advertise-addr",
+			conf: ServerConfig{AdvertiseAddr: "some-host"},
+			err:  errors.New("invalid AdvertiseAddr"),
+		},
+		{
+			name: "both-advertise-addr-and-interface",
+			conf: ServerConfig{AdvertiseAddr: "10.0.0.1", AdvertiseInterface: "eth0"},
+			err:  errors.New("only one of AdvertiseAddr and AdvertiseInterface can be set"),
+		},
+		{
+			name: "invalid-advertise-grpc-addr",
+			conf: ServerConfig{AdvertiseGRPCAddr: "public-host"},
+			err:  errors.New("invalid AdvertiseGRPCAddr"),
+		},
+	}
+
+	for _, e := range table {
+		t.Run(e.name, func(t *testing.T) {
+			assert.Equal(t, e.err, validateAddressConfig(e.conf))
+		})
+	}
+}
+
+func TestConfigureMemberlistAddrs(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		mconf := memberlist.DefaultLANConfig()
+		err := configureMemberlistAddrs(ServerConfig{GRPCPort: 5001}, mconf, 2000)
+		assert.Equal(t, nil, err)
+		assert.Equal(t, "0.0.0.0", mconf.BindAddr)
+		assert.Equal(t, 7001, mconf.BindPort)
+		assert.Equal(t, "", mconf.AdvertiseAddr)
+		assert.Equal(t, 7001, mconf.AdvertisePort)
+	})
+
+	t.Run("advertise-addr", func(t *testing.T) {
+		mconf := memberlist.DefaultLANConfig()
+		err := configureMemberlistAddrs(ServerConfig{
+			GRPCPort:       5001,
+			MemberlistPort: 6001,
+			BindAddr:       "192.168.1.2",
+			AdvertiseAddr:  "10.0.0.1",
+		}, mconf, 2000)
+		assert.Equal(t, nil, err)
+		assert.Equal(t, "192.168.1.2", mconf.BindAddr)
+		assert.Equal(t, 6001, mconf.BindPort)
+		assert.Equal(t, "10.0.0.1", mconf.AdvertiseAddr)
+		assert.Equal(t, 6001, mconf.AdvertisePort)
+	})
+
+	t.Run("advertise-addr-with-port", func(t *testing.T) {
+		mconf := memberlist.DefaultLANConfig()
+		err := configureMemberlistAddrs(ServerConfig{
+			GRPCPort:      5001,
+			AdvertiseAddr: "10.0.0.1:31000",
+		}, mconf, 2000)
+		assert.Equal(t, nil, err)
+		assert.Equal(t, "10.0.0.1", mconf.AdvertiseAddr)
+		assert.Equal(t, 31000, mconf.AdvertisePort)
+	})
+
+	t.Run("advertise-interface", func(t *testing.T) {
+		mconf := memberlist.DefaultLANConfig()
+		err := configureMemberlistAddrs(ServerConfig{
+			GRPCPort:           5001,
+			AdvertiseInterface: "lo",
+		}, mconf, 2000)
+		assert.Equal(t, nil, err)
+		assert.Equal(t, "127.0.0.1", mconf.AdvertiseAddr)
+		assert.Equal(t, 7001, mconf.AdvertisePort)
+	})
+
+	t.Run("advertise-interface-not-found", func(t *testing.T) {
+		mconf := memberlist.DefaultLANConfig()
+		err := configureMemberlistAddrs(ServerConfig{
+			GRPCPort:           5001,
+			AdvertiseInterface: "not-found-interface",
+		}, mconf, 2000)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,136 @@
+package goblin
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/x509"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"strings"
+)
+
+// WatchAuthorizer checks whether the caller of GoblinService RPCs is allowed,
+// returns nil when allowed. Returned errors should be gRPC status errors,
+// other errors are converted to codes.PermissionDenied
+type WatchAuthorizer func(ctx context.Context) error
+
+const authorizationHeader = "authorization"
+const bearerPrefix = "Bearer "
+
+func allowAllAuthorizer(context.Context) error {
+	return nil
+}
+
+func authorize(ctx context.Context, authorizer WatchAuthorizer) error {
+	err := authorizer(ctx)
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	return status.Error(codes.PermissionDenied, err.Error())
+}
+
+// BearerTokenAuthorizer allows callers that send the header "authorization: Bearer <token>"
+// with one of the tokens
+func BearerTokenAuthorizer(tokens ...string) WatchAuthorizer {
+	return func(ctx context.Context) error {
+		md, ok := metadata.FromIncomingContext(ctx)
+		if !ok {
+			return status.Error(codes.Unauthenticated, "missing metadata")
+		}
+
+		for _, value := range md.Get(authorizationHeader) {
+			if !strings.HasPrefix(value, bearerPrefix) {
+				continue
+			}
+			if tokenMatched(strings.TrimPrefix(value, bearerPrefix), tokens) {
+				return nil
+			}
+		}
+		return status.Error(codes.Unauthenticated, "invalid bearer token")
+	}
+}
+
+func tokenMatched(token string, tokens []string) bool {
+	for _, t := range tokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(t)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// MTLSSANAuthorizer allows callers that present a verified client certificate
+// having one of the subject alternative names (DNS names, URIs, emails or IP addresses)
+func MTLSSANAuthorizer(allowedSANs ...string) WatchAuthorizer {
+	allowed := map[string]struct{}{}
+	for _, san := range allowedSANs {
+		allowed[san] = struct{}{}
+	}
+
+	return func(ctx context.Context) error {
+		p, ok := peer.FromContext(ctx)
+		if !ok {
+			return status.Error(codes.Unauthenticated, "missing peer info")
+		}
+
+		tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+		if !ok {
+			return status.Error(codes.Unauthenticated, "not a TLS connection")
+		}
+
+		for _, chain := range tlsInfo.State.VerifiedChains {
+			if len(chain) > 0 && certificateAllowed(chain[0], allowed) {
+				return nil
+			}
+		}
+		return status.Error(codes.PermissionDenied, "client certificate is not allowed")
+	}
+}
+
+func certificateAllowed(cert *x509.Certificate, allowed map[string]struct{}) bool {
+	sans := make([]string, 0, len(cert.DNSNames)+len(cert.EmailAddresses)+len(cert.URIs)+len(cert.IPAddresses))
+	sans = append(sans, cert.DNSNames...)
+	sans = append(sans, cert.EmailAddresses...)
+	for _, uri := range cert.URIs {
+		sans = append(sans, uri.String())
+	}
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+
+	for _, san := range sans {
+		if _, existed := allowed[san]; existed {
+			return true
+		}
+	}
+	return false
+}
+
+// BearerTokenCredentials is the client side of BearerTokenAuthorizer,
+// use it with grpc.WithPerRPCCredentials in ClientConfig.Options or ServerConfig.DialOptions
+type BearerTokenCredentials struct {
+	Token string
+
+	// AllowInsecure allows sending the token without transport security
+	AllowInsecure bool
+}
+
+var _ credentials.PerRPCCredentials = BearerTokenCredentials{}
+
+// GetRequestMetadata returns the authorization header
+func (c BearerTokenCredentials) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	return map[string]string{
+		authorizationHeader: bearerPrefix + c.Token,
+	}, nil
+}
+
+// RequireTransportSecurity returns true if AllowInsecure is false
+func (c BearerTokenCredentials) RequireTransportSecurity() bool {
+	return !c.AllowInsecure
+}
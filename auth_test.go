@@ -0,0 +1,135 @@
+package goblin
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"net/url"
+	"testing"
+)
+
+func assertStatusError(t *testing.T, code codes.Code, msg string, err error) {
+	t.Helper()
+	st, ok := status.FromError(err)
+	assert.Equal(t, true, ok)
+	assert.Equal(t, code, st.Code())
+	assert.Equal(t, msg, st.Message())
+}
+
+func TestWithWatchAuthorizer_Nil(t *testing.T) {
+	opts := computeServerOptions(WithWatchAuthorizer(nil))
+	err := authorize(context.Background(), opts.watchAuthorizer)
+	assert.Equal(t, nil, err)
+}
+
+func TestAuthorize(t *testing.T) {
+	t.Run("allowed", func(t *testing.T) {
+		err := authorize(context.Background(), allowAllAuthorizer)
+		assert.Equal(t, nil, err)
+	})
+
+	t.Run("status-error", func(t *testing.T) {
+		err := authorize(context.Background(), func(ctx context.Context) error {
+			return status.Error(codes.Unauthenticated, "some error")
+		})
+		assertStatusError(t, codes.Unauthenticated, "some error", err)
+	})
+
+	t.Run("normal-error", func(t *testing.T) {
+		err := authorize(context.Background(), func(ctx context.Context) error {
+			return errors.New("some error")
+		})
+		assertStatusError(t, codes.PermissionDenied, "some error", err)
+	})
+}
+
+func TestBearerTokenAuthorizer(t *testing.T) {
+	authorizer := BearerTokenAuthorizer("token-1", "token-2")
+
+	t.Run("no-metadata", func(t *testing.T) {
+		err := authorizer(context.Background())
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	})
+
+	t.Run("wrong-token", func(t *testing.T) {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer token-3"))
+		err := authorizer(ctx)
+		assertStatusError(t, codes.Unauthenticated, "invalid bearer token", err)
+	})
+
+	t.Run("missing-prefix", func(t *testing.T) {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "token-1"))
+		err := authorizer(ctx)
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	})
+
+	t.Run("normal", func(t *testing.T) {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer token-2"))
+		err := authorizer(ctx)
+		assert.Equal(t, nil, err)
+	})
+}
+
+func newTLSPeerContext(cert *x509.Certificate) context.Context {
+	return peer.NewContext(context.Background(), &peer.Peer{
+		AuthInfo: credentials.TLSInfo{
+			State: tls.ConnectionState{
+				VerifiedChains: [][]*x509.Certificate{{cert}},
+			},
+		},
+	})
+}
+
+func TestMTLSSANAuthorizer(t *testing.T) {
+	authorizer := MTLSSANAuthorizer("client.example.com", "spiffe://cluster/ns/default/sa/app")
+
+	t.Run("no-peer", func(t *testing.T) {
+		err := authorizer(context.Background())
+		assertStatusError(t, codes.Unauthenticated, "missing peer info", err)
+	})
+
+	t.Run("not-tls", func(t *testing.T) {
+		ctx := peer.NewContext(context.Background(), &peer.Peer{})
+		err := authorizer(ctx)
+		assertStatusError(t, codes.Unauthenticated, "not a TLS connection", err)
+	})
+
+	t.Run("dns-name", func(t *testing.T) {
+		err := authorizer(newTLSPeerContext(&x509.Certificate{
+			DNSNames: []string{"other.example.com", "client.example.com"},
+		}))
+		assert.Equal(t, nil, err)
+	})
+
+	t.Run("uri", func(t *testing.T) {
+		uri, err := url.Parse("spiffe://cluster/ns/default/sa/app")
+		assert.Equal(t, nil, err)
+
+		err = authorizer(newTLSPeerContext(&x509.Certificate{
+			URIs: []*url.URL{uri},
+		}))
+		assert.Equal(t, nil, err)
+	})
+
+	t.Run("not-allowed", func(t *testing.T) {
+		err := authorizer(newTLSPeerContext(&x509.Certificate{
+			DNSNames: []string{"other.example.com"},
+		}))
+		assertStatusError(t, codes.PermissionDenied, "client certificate is not allowed", err)
+	})
+}
+
+func TestBearerTokenCredentials(t *testing.T) {
+	c := BearerTokenCredentials{Token: "token-1"}
+	md, err := c.GetRequestMetadata(context.Background())
+	assert.Equal(t, nil, err)
+	assert.Equal(t, map[string]string{"authorization": "Bearer token-1"}, md)
+	assert.Equal(t, true, c.RequireTransportSecurity())
+}
@@ -0,0 +1,222 @@
+package goblin
+
+import (
+	"errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrCircuitOpen when the circuit breakers of the requested nodes are open
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// BreakerState is the state of the circuit breaker of a node
+type BreakerState uint32
+
+const (
+	// BreakerClosed requests are sent to the node normally
+	BreakerClosed BreakerState = iota
+	// BreakerOpen the node is skipped until the cooldown is over
+	BreakerOpen
+	// BreakerHalfOpen a limited number of probe requests are sent to the node
+	BreakerHalfOpen
+)
+
+// String returns the name of the state
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// CircuitBreaker configures the circuit breakers of pooled nodes
+type CircuitBreaker struct {
+	// FailureThreshold is the number of consecutive failures that opens the circuit, zero disables
+	FailureThreshold int
+
+	// Cooldown is the duration the circuit stays open before probing the node (default 10s).
+	// Probes that did not finish within a cooldown are replaced by new ones
+	Cooldown time.Duration
+
+	// HalfOpenProbes is the number of requests allowed while half-open (default 1),
+	// the circuit is closed on the first success and opened again on the first failure
+	HalfOpenProbes int
+
+	// IsFailure reports whether an error of a request counts as a node failure, by default only
+	// errors with codes Unavailable, DeadlineExceeded and ResourceExhausted. Dial errors are always failures
+	IsFailure func(err error) bool
+}
+
+func (c CircuitBreaker) withDefaults() CircuitBreaker {
+	if c.Cooldown <= 0 {
+		c.Cooldown = 10 * time.Second
+	}
+	if c.HalfOpenProbes <= 0 {
+		c.HalfOpenProbes = 1
+	}
+	if c.IsFailure == nil {
+		c.IsFailure = isNodeFailure
+	}
+	return c
+}
+
+func isNodeFailure(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted:
+		return true
+	default:
+		return false
+	}
+}
+
+// circuitBreaker is shared by the sub-connections of a node
+type circuitBreaker struct {
+	conf CircuitBreaker
+
+	state uint32 // BreakerState, written under mu, read without lock for the closed fast path
+
+	mu       sync.Mutex
+	failures int       // consecutive failures while closed
+	since    time.Time // the time of opening or of starting the current probes
+	probes   int       // the probes admitted since the time above
+}
+
+func newCircuitBreaker(conf CircuitBreaker) *circuitBreaker {
+	return &circuitBreaker{conf: conf}
+}
+
+func (b *circuitBreaker) getState() BreakerState {
+	return BreakerState(atomic.LoadUint32(&b.state))
+}
+
+func (b *circuitBreaker) setStateLocked(state BreakerState, now time.Time) {
+	atomic.StoreUint32(&b.state, uint32(state))
+	b.failures = 0
+	b.since = now
+	b.probes = 0
+}
+
+// allow returns false if the request must skip the node
+func (b *circuitBreaker) allow(now time.Time) bool {
+	if b.getState() == BreakerClosed {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	state := b.getState()
+	if state == BreakerClosed {
+		return true
+	}
+	if now.Sub(b.since) >= b.conf.Cooldown {
+		b.setStateLocked(BreakerHalfOpen, now)
+	} else if state == BreakerOpen {
+		return false
+	}
+
+	if b.probes >= b.conf.HalfOpenProbes {
+		return false
+	}
+	b.probes++
+	return true
+}
+
+func (b *circuitBreaker) onResult(now time.Time, failure bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.getState() {
+	case BreakerClosed:
+		if !failure {
+			b.failures = 0
+			return
+		}
+		b.failures++
+		if b.failures >= b.conf.FailureThreshold {
+			b.setStateLocked(BreakerOpen, now)
+		}
+
+	case BreakerHalfOpen:
+		if failure {
+			b.setStateLocked(BreakerOpen, now)
+		} else {
+			b.setStateLocked(BreakerClosed, now)
+		}
+
+	default:
+		// results of requests started before opening
+	}
+}
+
+func (c *clientConn) getBreaker() *circuitBreaker {
+	if c.state == nil {
+		return nil
+	}
+	return c.state.breaker
+}
+
+// recordBreakerResult a nil err is a success
+func (c *PoolClient) recordBreakerResult(conn *clientConn, err error) {
+	b := conn.getBreaker()
+	if b == nil {
+		return
+	}
+	b.onResult(c.getNow(), err != nil && b.conf.IsFailure(err))
+}
+
+// recordDialFailure opens the circuit of nodes that can not be connected
+func (c *PoolClient) recordDialFailure(conn *clientConn) {
+	if b := conn.getBreaker(); b != nil {
+		b.onResult(c.getNow(), true)
+	}
+}
+
+// tryAcquireConn is tryAcquire that also checks the global limit and the circuit breaker,
+// open = true if the circuit breaker rejects the request. Must be released by releaseConn
+func (c *PoolClient) tryAcquireConn(conn *clientConn) (ok bool, saturated bool, open bool) {
+	ok, saturated = conn.tryAcquire()
+	if !ok {
+		return false, saturated, false
+	}
+	if !c.tryAcquireGlobal() {
+		releaseAndClose(conn)
+		return false, true, false
+	}
+
+	b := conn.getBreaker()
+	if b != nil && !b.allow(c.getNow()) {
+		c.releaseConn(conn)
+		return false, false, true
+	}
+	return true, false, false
+}
+
+// GetBreakerState returns the circuit breaker state of a node, false if the node is not in the pool.
+// Always BreakerClosed when circuit breakers are disabled (see WithCircuitBreaker)
+func (c *PoolClient) GetBreakerState(nodeName string) (BreakerState, bool) {
+	tmp := c.getClientConns()
+	if tmp == nil {
+		return BreakerClosed, false
+	}
+
+	for _, conn := range tmp.conns {
+		if conn.nodeName != nodeName {
+			continue
+		}
+		if b := conn.getBreaker(); b != nil {
+			return b.getState(), true
+		}
+		return BreakerClosed, true
+	}
+	return BreakerClosed, false
+}
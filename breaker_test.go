@@ -0,0 +1,241 @@
+package goblin
+
+import (
+	"context"
+	"errors"
+	"github.com/QuangTung97/goblin/goblinpb"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"testing"
+	"time"
+)
+
+func newTestBreaker(threshold int, probes int) *circuitBreaker {
+	return newCircuitBreaker(CircuitBreaker{
+		FailureThreshold: threshold,
+		Cooldown:         10 * time.Second,
+		HalfOpenProbes:   probes,
+	}.withDefaults())
+}
+
+func TestBreakerState_String(t *testing.T) {
+	assert.Equal(t, "closed", BreakerClosed.String())
+	assert.Equal(t, "open", BreakerOpen.String())
+	assert.Equal(t, "half-open", BreakerHalfOpen.String())
+	assert.Equal(t, "unknown", BreakerState(10).String())
+}
+
+func TestIsNodeFailure(t *testing.T) {
+	assert.Equal(t, false, isNodeFailure(errors.New("some error")))
+	assert.Equal(t, false, isNodeFailure(status.Error(codes.NotFound, "not found")))
+	assert.Equal(t, true, isNodeFailure(status.Error(codes.Unavailable, "unavailable")))
+	assert.Equal(t, true, isNodeFailure(status.Error(codes.DeadlineExceeded, "deadline")))
+	assert.Equal(t, true, isNodeFailure(status.Error(codes.ResourceExhausted, "exhausted")))
+}
+
+func TestCircuitBreaker_Open_After_Consecutive_Failures(t *testing.T) {
+	b := newTestBreaker(3, 1)
+	now := time.Now()
+
+	b.onResult(now, true)
+	b.onResult(now, true)
+	b.onResult(now, false)
+	b.onResult(now, true)
+	b.onResult(now, true)
+	assert.Equal(t, BreakerClosed, b.getState())
+	assert.Equal(t, true, b.allow(now))
+
+	b.onResult(now, true)
+	assert.Equal(t, BreakerOpen, b.getState())
+	assert.Equal(t, false, b.allow(now))
+	assert.Equal(t, false, b.allow(now.Add(9*time.Second)))
+
+	// results of requests started before opening
+	b.onResult(now, false)
+	assert.Equal(t, BreakerOpen, b.getState())
+}
+
+func TestCircuitBreaker_Half_Open(t *testing.T) {
+	b := newTestBreaker(1, 2)
+	now := time.Now()
+
+	b.onResult(now, true)
+	assert.Equal(t, BreakerOpen, b.getState())
+
+	now = now.Add(10 * time.Second)
+	assert.Equal(t, true, b.allow(now))
+	assert.Equal(t, BreakerHalfOpen, b.getState())
+	assert.Equal(t, true, b.allow(now))
+	assert.Equal(t, false, b.allow(now))
+
+	// probe failed
+	b.onResult(now, true)
+	assert.Equal(t, BreakerOpen, b.getState())
+	assert.Equal(t, false, b.allow(now.Add(5*time.Second)))
+
+	now = now.Add(10 * time.Second)
+	assert.Equal(t, true, b.allow(now))
+	b.onResult(now, false)
+	assert.Equal(t, BreakerClosed, b.getState())
+	assert.Equal(t, true, b.allow(now))
+
+	// failures are counted again from zero
+	b.onResult(now, true)
+	assert.Equal(t, BreakerOpen, b.getState())
+}
+
+func TestCircuitBreaker_Half_Open_Probes_Not_Finished(t *testing.T) {
+	b := newTestBreaker(1, 1)
+	now := time.Now()
+
+	b.onResult(now, true)
+
+	now = now.Add(10 * time.Second)
+	assert.Equal(t, true, b.allow(now))
+	assert.Equal(t, false, b.allow(now.Add(5*time.Second)))
+
+	// the probe is replaced after a cooldown
+	assert.Equal(t, true, b.allow(now.Add(10*time.Second)))
+	assert.Equal(t, BreakerHalfOpen, b.getState())
+}
+
+func TestPoolClient_AcquireNextConn_Skip_Open_Circuit(t *testing.T) {
+	conn1 := &clientConn{nodeName: "name-1", refCount: 1, state: newConnState()}
+	conn1.state.breaker = newTestBreaker(1, 1)
+	conn2 := &clientConn{nodeName: "name-2", refCount: 1, state: newConnState()}
+	conn2.state.breaker = newTestBreaker(1, 1)
+
+	now := time.Now()
+	pool := makePoolClient(ClientConfig{})
+	pool.getNow = func() time.Time { return now }
+	pool.setClientConns(&clientConns{conns: []*clientConn{conn1, conn2}})
+
+	pool.recordBreakerResult(conn1, status.Error(codes.Unavailable, "unavailable"))
+	pool.recordBreakerResult(conn2, status.Error(codes.NotFound, "not found"))
+
+	state, ok := pool.GetBreakerState("name-1")
+	assert.Equal(t, true, ok)
+	assert.Equal(t, BreakerOpen, state)
+
+	state, ok = pool.GetBreakerState("name-2")
+	assert.Equal(t, true, ok)
+	assert.Equal(t, BreakerClosed, state)
+
+	_, ok = pool.GetBreakerState("name-3")
+	assert.Equal(t, false, ok)
+
+	for i := 0; i < 4; i++ {
+		result, err := pool.acquireNextConn()
+		assert.Equal(t, nil, err)
+		assert.Same(t, conn2, result)
+	}
+	assert.Equal(t, uint64(1), conn1.refCount)
+
+	_, err := pool.acquireConnByName("name-1")
+	assert.Equal(t, ErrCircuitOpen, err)
+
+	pool.recordDialFailure(conn2)
+	_, err = pool.acquireNextConn()
+	assert.Equal(t, ErrCircuitOpen, err)
+
+	// half-open
+	now = now.Add(10 * time.Second)
+	result, err := pool.acquireConnByName("name-1")
+	assert.Equal(t, nil, err)
+	assert.Same(t, conn1, result)
+
+	state, _ = pool.GetBreakerState("name-1")
+	assert.Equal(t, BreakerHalfOpen, state)
+}
+
+func TestComputeNewClientConns_Shared_Breaker(t *testing.T) {
+	factory := newTestConnFactory(func(addr string) (*grpc.ClientConn, error) {
+		return nil, nil
+	})
+	factory.connsPerNode = 2
+	factory.breaker = CircuitBreaker{FailureThreshold: 2}.withDefaults()
+
+	result, _ := computeNewClientConns(nil, []*goblinpb.Node{
+		{Name: "name-1", Addr: "some-host-1:5800"},
+		{Name: "name-2", Addr: "some-host-2:5800"},
+	}, factory)
+
+	assert.Equal(t, 4, len(result.conns))
+	assert.Same(t, result.conns[0].state.breaker, result.conns[1].state.breaker)
+	assert.Same(t, result.conns[2].state.breaker, result.conns[3].state.breaker)
+	assert.NotSame(t, result.conns[0].state.breaker, result.conns[2].state.breaker)
+
+	// disabled
+	factory.breaker = CircuitBreaker{}
+	result, _ = computeNewClientConns(nil, []*goblinpb.Node{
+		{Name: "name-1", Addr: "some-host-1:5800"},
+	}, factory)
+	assert.Nil(t, result.conns[0].state.breaker)
+}
+
+func TestPoolClient_GetConn_Opens_Circuit(t *testing.T) {
+	pool, conn := newFakeServerPoolClient(t)
+	conn.state.breaker = newTestBreaker(2, 1)
+
+	for i := 0; i < 2; i++ {
+		err := pool.GetConn(func(conn *grpc.ClientConn) error {
+			return status.Error(codes.Unavailable, "unavailable")
+		})
+		assert.Equal(t, codes.Unavailable, status.Code(err))
+	}
+
+	err := pool.GetConn(func(conn *grpc.ClientConn) error {
+		return nil
+	})
+	assert.Equal(t, ErrCircuitOpen, err)
+}
+
+// newHalfOpenTestPool returns a pool with a circuit breaker whose cooldown is over
+func newHalfOpenTestPool(t *testing.T) (*PoolClient, *circuitBreaker) {
+	pool, conn := newFakeServerPoolClient(t)
+	b := newTestBreaker(1, 1)
+	b.onResult(time.Now(), true)
+	conn.state.breaker = b
+
+	now := time.Now().Add(11 * time.Second)
+	pool.getNow = func() time.Time { return now }
+	return pool, b
+}
+
+func TestPoolClient_Lease_Reports_Breaker_Result(t *testing.T) {
+	pool, b := newHalfOpenTestPool(t)
+
+	lease, err := pool.Lease()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, BreakerHalfOpen, b.getState())
+
+	_, err = goblinpb.NewGoblinServiceClient(lease).GetNode(context.Background(), &goblinpb.GetNodeRequest{})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, BreakerClosed, b.getState())
+	lease.Release()
+}
+
+func TestPoolClient_GetConnStream_Reports_Breaker_Result(t *testing.T) {
+	pool, b := newHalfOpenTestPool(t)
+
+	err := pool.GetConnStream(func(conn *grpc.ClientConn, done <-chan struct{}) error {
+		assert.Equal(t, BreakerHalfOpen, b.getState())
+		return status.Error(codes.Unavailable, "unavailable")
+	})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.Equal(t, BreakerOpen, b.getState())
+}
+
+func TestPoolClient_ClientConn_NewStream_Reports_Breaker_Result(t *testing.T) {
+	pool, b := newHalfOpenTestPool(t)
+	client := goblinpb.NewGoblinServiceClient(pool.ClientConn())
+
+	stream, err := client.Watch(context.Background(), &goblinpb.WatchRequest{})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, BreakerClosed, b.getState())
+
+	_, err = stream.Recv()
+	assert.Equal(t, nil, err)
+}
@@ -0,0 +1,128 @@
+package goblin
+
+import (
+	"github.com/QuangTung97/goblin/goblinpb"
+	"google.golang.org/protobuf/proto"
+	"sort"
+	"sync"
+)
+
+// encodedMessage is a pre-encoded proto message (goblinpb.NodeList or goblinpb.ShardMap), it implements the legacy proto Marshaler
+// so that the gRPC codec sends the encoded bytes as is
+type encodedMessage struct {
+	data []byte
+}
+
+func (m *encodedMessage) Reset() {
+}
+
+func (m *encodedMessage) String() string {
+	return "encodedMessage"
+}
+
+func (m *encodedMessage) ProtoMessage() {
+}
+
+func (m *encodedMessage) Marshal() ([]byte, error) {
+	return m.data, nil
+}
+
+func nodesToNodeList(seq uint64, nodes map[string]Node) *goblinpb.NodeList {
+	output := make([]*goblinpb.Node, 0, len(nodes))
+	for name, n := range nodes {
+		output = append(output, &goblinpb.Node{
+			Name:     name,
+			Addr:     n.Addr,
+			Load:     n.Load,
+			GrpcAddr: n.GRPCAddr,
+		})
+	}
+	sort.Slice(output, func(i, j int) bool {
+		return output[i].Name < output[j].Name
+	})
+
+	return &goblinpb.NodeList{
+		Nodes: output,
+		Seq:   seq,
+	}
+}
+
+func encodeNodeList(seq uint64, nodes map[string]Node) (*encodedMessage, error) {
+	data, err := proto.Marshal(nodesToNodeList(seq, nodes))
+	if err != nil {
+		return nil, err
+	}
+	return &encodedMessage{data: data}, nil
+}
+
+type watchSubscriber struct {
+	ch chan *encodedMessage
+}
+
+// push never blocks, when the buffer is full the oldest snapshot is dropped,
+// slow subscribers skip to the latest snapshot
+func (s *watchSubscriber) push(msg *encodedMessage) {
+	for {
+		select {
+		case s.ch <- msg:
+			return
+		default:
+		}
+
+		select {
+		case <-s.ch:
+		default:
+		}
+	}
+}
+
+// snapshotBroadcaster fans out encoded snapshots (of membership or shard map) to all watch streams
+type snapshotBroadcaster struct {
+	bufferSize int
+
+	mu          sync.Mutex
+	last        *encodedMessage
+	subscribers map[*watchSubscriber]struct{}
+}
+
+func newSnapshotBroadcaster(bufferSize int) *snapshotBroadcaster {
+	if bufferSize < 1 {
+		bufferSize = 1
+	}
+	return &snapshotBroadcaster{
+		bufferSize:  bufferSize,
+		subscribers: map[*watchSubscriber]struct{}{},
+	}
+}
+
+// subscribe returns a subscriber that receives the latest snapshot immediately (if any)
+func (b *snapshotBroadcaster) subscribe() *watchSubscriber {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sub := &watchSubscriber{
+		ch: make(chan *encodedMessage, b.bufferSize),
+	}
+	if b.last != nil {
+		sub.ch <- b.last
+	}
+	b.subscribers[sub] = struct{}{}
+	return sub
+}
+
+func (b *snapshotBroadcaster) unsubscribe(sub *watchSubscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.subscribers, sub)
+}
+
+func (b *snapshotBroadcaster) publish(msg *encodedMessage) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.last = msg
+	for sub := range b.subscribers {
+		sub.push(msg)
+	}
+}
@@ -0,0 +1,86 @@
+package goblin
+
+import (
+	"github.com/QuangTung97/goblin/goblinpb"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/protobuf/proto"
+	"testing"
+)
+
+func decodeNodeList(t *testing.T, msg *encodedMessage) (uint64, []*goblinpb.Node) {
+	t.Helper()
+	var nodeList goblinpb.NodeList
+	err := proto.Unmarshal(msg.data, &nodeList)
+	assert.Equal(t, nil, err)
+
+	var result []*goblinpb.Node
+	for _, n := range nodeList.Nodes {
+		result = append(result, &goblinpb.Node{Name: n.Name, Addr: n.Addr})
+	}
+	return nodeList.Seq, result
+}
+
+func TestEncodeNodeList(t *testing.T) {
+	msg, err := encodeNodeList(11, map[string]Node{
+		"name-2": {Addr: "address-2"},
+		"name-1": {Addr: "address-1"},
+	})
+	assert.Equal(t, nil, err)
+
+	seq, nodes := decodeNodeList(t, msg)
+	assert.Equal(t, uint64(11), seq)
+	assert.Equal(t, []*goblinpb.Node{
+		{Name: "name-1", Addr: "address-1"},
+		{Name: "name-2", Addr: "address-2"},
+	}, nodes)
+}
+
+func TestEncodedNodeList_GRPCCodec(t *testing.T) {
+	msg := &encodedMessage{data: []byte{1, 2, 3}}
+	data, err := encoding.GetCodec("proto").Marshal(msg)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []byte{1, 2, 3}, data)
+}
+
+func TestSnapshotBroadcaster_Subscribe_Receive_Latest(t *testing.T) {
+	b := newSnapshotBroadcaster(2)
+
+	sub1 := b.subscribe()
+	assert.Equal(t, 0, len(sub1.ch))
+
+	msg1 := &encodedMessage{data: []byte("msg-1")}
+	b.publish(msg1)
+	assert.Equal(t, msg1, <-sub1.ch)
+
+	sub2 := b.subscribe()
+	assert.Equal(t, 1, len(sub2.ch))
+	assert.Equal(t, msg1, <-sub2.ch)
+}
+
+func TestSnapshotBroadcaster_Slow_Subscriber_Skip_To_Latest(t *testing.T) {
+	b := newSnapshotBroadcaster(2)
+	sub := b.subscribe()
+
+	msg1 := &encodedMessage{data: []byte("msg-1")}
+	msg2 := &encodedMessage{data: []byte("msg-2")}
+	msg3 := &encodedMessage{data: []byte("msg-3")}
+
+	b.publish(msg1)
+	b.publish(msg2)
+	b.publish(msg3)
+
+	assert.Equal(t, 2, len(sub.ch))
+	assert.Equal(t, msg2, <-sub.ch)
+	assert.Equal(t, msg3, <-sub.ch)
+}
+
+func TestSnapshotBroadcaster_Unsubscribe(t *testing.T) {
+	b := newSnapshotBroadcaster(2)
+	sub := b.subscribe()
+	b.unsubscribe(sub)
+
+	b.publish(&encodedMessage{data: []byte("msg-1")})
+	assert.Equal(t, 0, len(sub.ch))
+	assert.Equal(t, 0, len(b.subscribers))
+}
@@ -3,13 +3,14 @@ package goblin
 import (
 	"context"
 	"errors"
-	"fmt"
 	"github.com/QuangTung97/goblin/goblinpb"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
-	"io"
+	"net"
+	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 	"unsafe"
@@ -18,6 +19,12 @@ import (
 // ErrNoConn when pool has not (or not yet) any connections
 var ErrNoConn = errors.New("no connection available")
 
+// ErrClosed when the pool client is closed
+var ErrClosed = errors.New("pool client is closed")
+
+// ErrInvalidAddress when a node address can not be parsed
+var ErrInvalidAddress = errors.New("invalid address")
+
 // ClientConfig for config client pooling
 type ClientConfig struct {
 	Addresses []string
@@ -25,12 +32,38 @@ type ClientConfig struct {
 }
 
 type clientConn struct {
-	conn     *grpc.ClientConn
+	conn     unsafe.Pointer // *grpc.ClientConn, nil before dialing when lazy connect is enabled
 	nodeName string
-	refCount uint64   // reference count, for closing connection if no one refer to
-	_padding [32]byte // to avoid false sharing (64 byte cache line)
+	addr     string     // gRPC address of the node
+	refCount uint64     // reference count, for closing connection if no one refer to
+	state    *connState // nil only in tests
+	_padding [8]byte    // to avoid false sharing (64 byte cache line)
+}
+
+// connState is the rarely accessed state of a clientConn
+type connState struct {
+	dialMu sync.Mutex
+	dial   func(addr string) (*grpc.ClientConn, error) // nil when lazy connect is disabled
+
+	done       chan struct{} // closed when the node is removed from the pool
+	removeOnce sync.Once
+
+	closed    chan struct{} // closed after the connection is closed
+	closeOnce sync.Once
+
+	load    atomicFloat64   // the load reported by the node
+	limiter *aimdLimiter    // nil when per-node concurrency limits are disabled
+	breaker *circuitBreaker // shared by the sub-connections of the node, nil when disabled
 }
 
+func newConnState() *connState {
+	return &connState{
+		done:   make(chan struct{}),
+		closed: make(chan struct{}),
+	}
+}
+
+// clientConns contains connsPerNode sub-connections for each node
 type clientConns struct {
 	conns []*clientConn
 }
@@ -41,105 +74,422 @@ type PoolClient struct {
 	seq     uint64
 	config  ClientConfig
 	options clientOptions
+
+	mu      sync.Mutex // for updating conns
+	sources []watchSourceState
+	members []string // gRPC addresses of the last known membership
+
+	lastSync   time.Time // the last time the membership view was known up to date
+	quarantine map[string]time.Time
+	invalid    map[string]string // node name => the memberlist address that can not be parsed
+	lastNodes  []*goblinpb.Node  // the last applied node list, before filtering quarantined nodes
+	retryTimer *time.Timer       // re-applies lastNodes when the earliest quarantine expires
+	getNow     func() time.Time
+
+	inFlight int64 // requests, leases and streams, only counted when GlobalMaxInFlight is set
+
+	closed uint32
+	ctx    context.Context
+	cancel func()
+	wg     sync.WaitGroup // for background goroutines
+
+	changedMu sync.Mutex
+	changed   chan struct{} // closed and replaced whenever conns changed
+
+	shards unsafe.Pointer // pointer to clientShardMap, nil before receiving
+
+	hedgeLatency *latencyTracker
 }
 
 // NewPoolClient ...
 func NewPoolClient(config ClientConfig, options ...ClientOption) *PoolClient {
 	client := makePoolClient(config, options...)
-	go client.watchNodes()
+	for i := range client.sources {
+		client.wg.Add(1)
+		go client.watchNodes(i)
+	}
+	if client.options.stalenessTTL > 0 {
+		client.wg.Add(1)
+		go client.checkStaleLoop()
+	}
+	if client.options.shardRouting {
+		client.wg.Add(1)
+		go client.watchShardMap()
+	}
 	return client
 }
 
 func makePoolClient(config ClientConfig, options ...ClientOption) *PoolClient {
+	opts := computeClientOptions(options...)
+	if opts.watchSources < 1 {
+		opts.watchSources = 1
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
 	return &PoolClient{
 		config:  config,
-		options: computeClientOptions(options...),
+		options: opts,
+		sources: make([]watchSourceState, opts.watchSources),
+		members: loadCachedMembers(opts),
+
+		lastSync:   time.Now(),
+		quarantine: map[string]time.Time{},
+		invalid:    map[string]string{},
+		getNow:     func() time.Time { return time.Now() },
+
+		ctx:    ctx,
+		cancel: cancel,
+
+		changed: make(chan struct{}),
+
+		hedgeLatency: newLatencyTracker(opts.hedgePercentile),
 	}
 }
 
-func (c *PoolClient) watchNodesSingleLoop(addr string) {
-	logger := c.options.logger
+func loadCachedMembers(opts clientOptions) []string {
+	if opts.memberCacheFile == "" {
+		return nil
+	}
 
-	conn, err := grpc.Dial(addr, c.config.Options...)
-	if err != nil {
-		logger.Error("dial for watch nodes", zap.Error(err))
-		time.Sleep(c.options.watchRetry)
-		return
+	members, err := loadMemberCache(opts.memberCacheFile)
+	if err != nil && !os.IsNotExist(err) {
+		opts.logger.Warn("loadMemberCache", zap.Error(err))
 	}
-	defer func() {
-		_ = conn.Close()
-	}()
+	return members
+}
 
-	client := goblinpb.NewGoblinServiceClient(conn)
-	stream, err := client.Watch(context.Background(), &goblinpb.WatchRequest{})
-	if err != nil {
-		logger.Error("watch nodes", zap.Error(err))
-		time.Sleep(c.options.watchRetry)
+func (c *PoolClient) updateClientConnsLocked(nodes []*goblinpb.Node) {
+	c.lastNodes = nodes
+	nodes = c.filterInvalidLocked(nodes)
+	nodes = c.filterQuarantinedLocked(nodes)
+	newClientConns, connErrors := computeNewClientConns(c.getClientConns(), nodes, connFactory{
+		portDiff:     int(c.options.portDiff),
+		connsPerNode: c.options.connsPerNode,
+		lazyConnect:  c.options.lazyConnect,
+		drainTimeout: c.options.drainTimeout,
+		limit:        c.options.concurrencyLimit,
+		breaker:      c.options.circuitBreaker,
+		dial: func(addr string) (*grpc.ClientConn, error) {
+			return grpc.DialContext(c.ctx, addr, c.config.Options...)
+		},
+	})
+	c.setClientConns(newClientConns)
+
+	for _, e := range connErrors {
+		c.options.logger.Error("create connection", zap.String("node", e.nodeName), zap.Error(e.err))
+		c.options.metrics.NodeConnError(e.nodeName, e.err)
+		if e.err == ErrInvalidAddress {
+			c.invalid[e.nodeName] = e.addr
+			continue
+		}
+		if c.options.quarantineTime > 0 {
+			c.quarantine[e.nodeName] = c.getNow().Add(c.options.quarantineTime)
+		}
+	}
+	c.scheduleQuarantineRetryLocked()
+}
+
+// filterInvalidLocked skips nodes whose addresses can not be parsed, until their addresses change
+func (c *PoolClient) filterInvalidLocked(nodes []*goblinpb.Node) []*goblinpb.Node {
+	if len(c.invalid) == 0 {
+		return nodes
+	}
+
+	current := map[string]string{}
+	result := make([]*goblinpb.Node, 0, len(nodes))
+	for _, node := range nodes {
+		current[node.Name] = node.Addr
+		if addr, existed := c.invalid[node.Name]; existed && addr == node.Addr && node.GrpcAddr == "" {
+			continue
+		}
+		result = append(result, node)
+	}
+
+	for name, addr := range c.invalid {
+		if current[name] != addr {
+			delete(c.invalid, name)
+		}
+	}
+	return result
+}
+
+// minQuarantineTime bounds the rate of retrying nodes that fail to create connections
+const minQuarantineTime = 10 * time.Millisecond
+
+// scheduleQuarantineRetryLocked retries quarantined nodes when the earliest quarantine expires,
+// without waiting for the next membership change
+func (c *PoolClient) scheduleQuarantineRetryLocked() {
+	if c.retryTimer != nil {
+		c.retryTimer.Stop()
+		c.retryTimer = nil
+	}
+	if len(c.quarantine) == 0 || c.options.quarantineTime <= 0 {
 		return
 	}
 
-	for {
-		nodeList, err := stream.Recv()
-		if err == io.EOF {
-			return
+	var earliest time.Time
+	for _, until := range c.quarantine {
+		if earliest.IsZero() || until.Before(earliest) {
+			earliest = until
 		}
-		if err != nil {
-			logger.Error("receive nodes", zap.Error(err))
-			time.Sleep(c.options.watchRetry)
+	}
+
+	c.retryTimer = time.AfterFunc(earliest.Sub(c.getNow()), func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		if c.isClosed() {
 			return
 		}
+		c.updateClientConnsLocked(c.lastNodes)
+	})
+}
 
-		c.handleNewNodeList(nodeList.Nodes)
+// filterQuarantinedLocked skips nodes that failed to create connections recently
+func (c *PoolClient) filterQuarantinedLocked(nodes []*goblinpb.Node) []*goblinpb.Node {
+	if len(c.quarantine) == 0 {
+		return nodes
 	}
-}
 
-func (c *PoolClient) watchNodes() {
-	index := 0
-	for ; ; index = (index + 1) % len(c.config.Addresses) {
-		addr := c.config.Addresses[index]
-		c.watchNodesSingleLoop(addr)
+	now := c.getNow()
+	nameSet := map[string]struct{}{}
+	result := make([]*goblinpb.Node, 0, len(nodes))
+	for _, node := range nodes {
+		nameSet[node.Name] = struct{}{}
+
+		until, existed := c.quarantine[node.Name]
+		if existed && now.Before(until) {
+			continue
+		}
+		delete(c.quarantine, node.Name)
+		result = append(result, node)
 	}
-}
 
-func (c *PoolClient) handleNewNodeList(nodes []*goblinpb.Node) {
-	portDiff := int(c.options.portDiff)
-	newClientConns := computeNewClientConns(c.getClientConns(), nodes, portDiff, func(addr string) *grpc.ClientConn {
-		conn, err := grpc.Dial(addr, c.config.Options...)
-		if err != nil {
-			panic(err)
+	for name := range c.quarantine {
+		if _, existed := nameSet[name]; !existed {
+			delete(c.quarantine, name)
 		}
-		return conn
-	})
-	c.setClientConns(newClientConns)
+	}
+	return result
 }
 
 func releaseAndClose(conn *clientConn) {
 	needClose := conn.release()
 	if needClose {
-		_ = conn.conn.Close()
+		conn.close()
 	}
 }
 
-func doRequestConn(conn *clientConn, fn func(conn *grpc.ClientConn) error) error {
+// removeClientConn is called when the node is removed from the pool. In-flight requests can continue
+// until drainTimeout (if not zero), after that the connection is force-closed
+func removeClientConn(conn *clientConn, drainTimeout time.Duration) {
+	if conn.state != nil {
+		conn.state.removeOnce.Do(func() {
+			close(conn.state.done)
+		})
+	}
+	releaseAndClose(conn)
+
+	if drainTimeout > 0 && atomic.LoadUint64(&conn.refCount) > 0 {
+		time.AfterFunc(drainTimeout, conn.close)
+	}
+}
+
+// doRequestConn the result of fn is used for the circuit breaker of the node,
+// and for adapting the concurrency limit (not for streams)
+func (c *PoolClient) doRequestConn(conn *clientConn, fn func(conn *grpc.ClientConn) error, isStream bool) error {
 	defer func() {
-		releaseAndClose(conn)
+		c.releaseConn(conn)
 	}()
-	return fn(conn.conn)
+
+	cc, err := conn.connect()
+	if err != nil {
+		c.options.metrics.NodeConnError(conn.nodeName, err)
+		c.recordDialFailure(conn)
+		return err
+	}
+
+	if isStream {
+		err = fn(cc)
+		c.recordBreakerResult(conn, err)
+		return err
+	}
+
+	begin := time.Now()
+	err = fn(cc)
+	conn.recordResult(time.Since(begin), err)
+	c.recordBreakerResult(conn, err)
+	return err
 }
 
-// GetConn get a connection from pool, DO *NOT* use conn outside the lifetime of current function
-func (c *PoolClient) GetConn(fn func(conn *grpc.ClientConn) error) error {
+// acquireNextConn returns a round-robin connection with its reference count increased,
+// skipping the nodes that reached their in-flight limits or have open circuit breakers
+func (c *PoolClient) acquireNextConn() (*clientConn, error) {
+	if c.globalOverloaded() {
+		return nil, ErrOverloaded
+	}
+
+	skipped := 0
+	saturatedCount := 0
 	for {
+		if c.isClosed() {
+			return nil, ErrClosed
+		}
+
 		conn, ok := c.getNextConn()
 		if !ok {
-			return ErrNoConn
+			if c.isClosed() {
+				return nil, ErrClosed
+			}
+			return nil, ErrNoConn
 		}
 
-		ok = conn.acquire()
-		if !ok {
+		ok, saturated, open := c.tryAcquireConn(conn)
+		if ok {
+			return conn, nil
+		}
+		if saturated {
+			saturatedCount++
+		}
+		if saturated || open {
+			skipped++
+			if skipped >= c.numConns() {
+				return nil, skippedConnsError(saturatedCount)
+			}
+		}
+	}
+}
+
+// skippedConnsError is the error when all connections are skipped
+func skippedConnsError(saturatedCount int) error {
+	if saturatedCount > 0 {
+		return ErrOverloaded
+	}
+	return ErrCircuitOpen
+}
+
+func (c *PoolClient) numConns() int {
+	conns := c.getClientConns()
+	if conns == nil {
+		return 0
+	}
+	return len(conns.conns)
+}
+
+// GetConn get a connection from pool, DO *NOT* use conn outside the lifetime of current function
+func (c *PoolClient) GetConn(fn func(conn *grpc.ClientConn) error) error {
+	conn, err := c.acquireNextConn()
+	if err != nil {
+		return err
+	}
+	return c.doRequestConn(conn, fn, false)
+}
+
+// GetConnContext is like GetConn but waits for a non-empty membership until ctx is done, instead of
+// returning ErrNoConn. Use grpc.WaitForReady(true) in calls to also wait for a healthy connection
+func (c *PoolClient) GetConnContext(ctx context.Context, fn func(conn *grpc.ClientConn) error) error {
+	for {
+		conn, err := c.acquireNextConn()
+		if err == nil {
+			return c.doRequestConn(conn, fn, false)
+		}
+		if err != ErrNoConn {
+			return err
+		}
+
+		err = c.WaitReady(ctx)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// WaitReady waits until the pool has at least one connection, returns ctx.Err() when ctx is done
+// or ErrClosed when the client is closed
+func (c *PoolClient) WaitReady(ctx context.Context) error {
+	for {
+		changed := c.connsChanged()
+		if c.isClosed() {
+			return ErrClosed
+		}
+		if c.hasConns() {
+			return nil
+		}
+
+		select {
+		case <-changed:
+		case <-c.ctx.Done():
+			return ErrClosed
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// GetConnStream is like GetConn but for long-lived streams, done is closed when the node is removed
+// from the pool, the stream should be finished before the drain timeout (WithDrainTimeout)
+func (c *PoolClient) GetConnStream(fn func(conn *grpc.ClientConn, done <-chan struct{}) error) error {
+	conn, err := c.acquireNextConn()
+	if err != nil {
+		return err
+	}
+	return c.doRequestConn(conn, func(cc *grpc.ClientConn) error {
+		return fn(cc, conn.doneChan())
+	}, true)
+}
+
+func (c *PoolClient) isClosed() bool {
+	return atomic.LoadUint32(&c.closed) != 0
+}
+
+// Close stops watching membership, waits for in-flight requests and leases to finish
+// (up to the close timeout, see WithCloseTimeout) and then closes all connections.
+// GetConn returns ErrClosed after Close is called
+func (c *PoolClient) Close() error {
+	if !atomic.CompareAndSwapUint32(&c.closed, 0, 1) {
+		return nil
+	}
+
+	c.cancel()
+	c.wg.Wait()
+
+	c.mu.Lock()
+	if c.retryTimer != nil {
+		c.retryTimer.Stop()
+	}
+	old := c.getClientConns()
+	c.setClientConns(&clientConns{})
+	c.mu.Unlock()
+
+	if old == nil {
+		return nil
+	}
+
+	for _, conn := range old.conns {
+		removeClientConn(conn, 0)
+	}
+	waitConnsClosed(old.conns, c.options.closeTimeout)
+
+	for _, conn := range old.conns {
+		conn.close()
+	}
+	return nil
+}
+
+func waitConnsClosed(conns []*clientConn, timeout time.Duration) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for _, conn := range conns {
+		if conn.state == nil {
 			continue
 		}
-		return doRequestConn(conn, fn)
+
+		select {
+		case <-conn.state.closed:
+		case <-timer.C:
+			return
+		}
 	}
 }
 
@@ -155,6 +505,88 @@ func (c *PoolClient) getClientConns() *clientConns {
 
 func (c *PoolClient) setClientConns(conns *clientConns) {
 	atomic.StorePointer(&c.conns, unsafe.Pointer(conns))
+
+	c.changedMu.Lock()
+	close(c.changed)
+	c.changed = make(chan struct{})
+	c.changedMu.Unlock()
+}
+
+func (c *PoolClient) connsChanged() <-chan struct{} {
+	c.changedMu.Lock()
+	defer c.changedMu.Unlock()
+	return c.changed
+}
+
+func (c *PoolClient) hasConns() bool {
+	conns := c.getClientConns()
+	return conns != nil && len(conns.conns) > 0
+}
+
+func (c *clientConn) close() {
+	closeFn := func() {
+		cc := c.getConn()
+		if cc != nil {
+			_ = cc.Close()
+		}
+	}
+
+	if c.state == nil {
+		closeFn()
+		return
+	}
+	c.state.closeOnce.Do(func() {
+		closeFn()
+		close(c.state.closed)
+	})
+}
+
+// doneChan returns a channel that is closed when the node is removed from the pool
+func (c *clientConn) doneChan() <-chan struct{} {
+	if c.state == nil {
+		return nil
+	}
+	return c.state.done
+}
+
+func (c *clientConn) getConn() *grpc.ClientConn {
+	return (*grpc.ClientConn)(atomic.LoadPointer(&c.conn))
+}
+
+// connect returns the underlying connection, dials it on first use if lazy connect is enabled
+func (c *clientConn) connect() (*grpc.ClientConn, error) {
+	conn := c.getConn()
+	if conn != nil || c.state == nil || c.state.dial == nil {
+		return conn, nil
+	}
+
+	c.state.dialMu.Lock()
+	defer c.state.dialMu.Unlock()
+
+	conn = c.getConn()
+	if conn != nil {
+		return conn, nil
+	}
+
+	conn, err := c.state.dial(c.addr)
+	if err != nil {
+		return nil, err
+	}
+	atomic.StorePointer(&c.conn, unsafe.Pointer(conn))
+	return conn, nil
+}
+
+func (c *clientConn) setLoad(load float64) {
+	if c.state != nil {
+		c.state.load.store(load)
+	}
+}
+
+func (c *clientConn) getLoad() float64 {
+	if c.state == nil {
+		return 0
+	}
+	return c.state.load.load()
 }
 
 func (c *clientConn) acquire() (ok bool) {
@@ -189,25 +621,150 @@ func (c *PoolClient) getNextConn() (*clientConn, bool) {
 	}
 
 	index := (newVal - 1) % uint64(len(conns))
+	if c.options.loadAware {
+		index = lessLoadedIndex(conns, index, newVal)
+	}
 	return conns[index], true
 }
 
-func getGRPCAddrFromMemberlist(addr string, portDiff int) string {
-	list := strings.Split(addr, ":")
-	if len(list) < 2 {
-		panic("invalid address")
+// lessLoadedIndex is the power of two choices: compares the round-robin candidate
+// with another pseudo-random one and returns the less loaded
+func lessLoadedIndex(conns []*clientConn, index uint64, seq uint64) uint64 {
+	n := uint64(len(conns))
+	if n < 2 {
+		return index
+	}
+
+	// multiplicative hashing to spread the second candidate
+	offset := 1 + ((seq*0x9E3779B97F4A7C15)>>32)%(n-1)
+	other := (index + offset) % n
+	if conns[other].getLoad() < conns[index].getLoad() {
+		return other
+	}
+	return index
+}
+
+// getGRPCAddrFromMemberlist also accepts IPv6 addresses without brackets from older nodes
+func getGRPCAddrFromMemberlist(addr string, portDiff int) (string, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		index := strings.LastIndex(addr, ":")
+		if index < 0 {
+			return "", ErrInvalidAddress
+		}
+		host, portStr = addr[:index], addr[index+1:]
+	}
+
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port-portDiff <= 0 {
+		return "", ErrInvalidAddress
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port-portDiff)), nil
+}
+
+// nodeGRPCAddr prefers the advertised gRPC address, computes it by the port difference for older nodes
+func nodeGRPCAddr(node *goblinpb.Node, portDiff int) (string, error) {
+	if node.GrpcAddr != "" {
+		return node.GrpcAddr, nil
+	}
+	return getGRPCAddrFromMemberlist(node.Addr, portDiff)
+}
+
+// connFactory creates client connections for new nodes
+type connFactory struct {
+	portDiff     int
+	connsPerNode int
+	lazyConnect  bool
+	drainTimeout time.Duration
+	limit        ConcurrencyLimit
+	breaker      CircuitBreaker
+	dial         func(addr string) (*grpc.ClientConn, error)
+}
+
+// nodeConnError is the error of creating a connection for a node
+type nodeConnError struct {
+	nodeName string
+	addr     string // memberlist address of the node
+	err      error
+}
+
+func (f connFactory) newClientConn(nodeName string, addr string, breaker *circuitBreaker) (*clientConn, error) {
+	result := &clientConn{
+		nodeName: nodeName,
+		addr:     addr,
+		refCount: 1,
+		state:    newConnState(),
+	}
+	if f.limit.NodeInitialLimit > 0 {
+		result.state.limiter = newAIMDLimiter(f.limit)
+	}
+	result.state.breaker = breaker
+	if f.lazyConnect {
+		result.state.dial = f.dial
+		return result, nil
+	}
+
+	conn, err := f.dial(addr)
+	if err != nil {
+		return nil, err
 	}
-	port, err := strconv.Atoi(list[1])
+	result.conn = unsafe.Pointer(conn)
+	return result, nil
+}
+
+// newNodeConns creates connsPerNode sub-connections for a node, all or nothing
+func (f connFactory) newNodeConns(node *goblinpb.Node) ([]*clientConn, error) {
+	addr, err := nodeGRPCAddr(node, f.portDiff)
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+
+	n := f.connsPerNode
+	if n < 1 {
+		n = 1
+	}
+
+	var breaker *circuitBreaker
+	if f.breaker.FailureThreshold > 0 {
+		breaker = newCircuitBreaker(f.breaker)
+	}
+
+	result := make([]*clientConn, 0, n)
+	for i := 0; i < n; i++ {
+		conn, err := f.newClientConn(node.Name, addr, breaker)
+		if err != nil {
+			for _, c := range result {
+				releaseAndClose(c)
+			}
+			return nil, err
+		}
+		conn.setLoad(node.Load)
+		result = append(result, conn)
+	}
+	return result, nil
+}
+
+// addrChangedNodes returns the nodes whose gRPC addresses changed, e.g. restarted with a stable name
+func addrChangedNodes(old *clientConns, newNodes map[string]*goblinpb.Node, portDiff int) map[string]struct{} {
+	result := map[string]struct{}{}
+	for _, conn := range old.conns {
+		node, existed := newNodes[conn.nodeName]
+		if !existed {
+			continue
+		}
+		addr, err := nodeGRPCAddr(node, portDiff)
+		if err == nil && addr != conn.addr {
+			result[conn.nodeName] = struct{}{}
+		}
 	}
-	return fmt.Sprintf("%s:%d", list[0], port-portDiff)
+	return result
 }
 
+// computeNewClientConns skips the nodes that failed to create connections and returns their errors.
+// Connections of a node are replaced if its address changed
 func computeNewClientConns(
-	old *clientConns, nodes []*goblinpb.Node, portDiff int,
-	dial func(addr string) *grpc.ClientConn,
-) *clientConns {
+	old *clientConns, nodes []*goblinpb.Node, factory connFactory,
+) (*clientConns, []nodeConnError) {
 	if old == nil {
 		old = &clientConns{}
 	}
@@ -217,35 +774,43 @@ func computeNewClientConns(
 		oldNameSet[conn.nodeName] = struct{}{}
 	}
 
-	newNameSet := map[string]struct{}{}
+	newNodes := map[string]*goblinpb.Node{}
 	for _, node := range nodes {
-		newNameSet[node.Name] = struct{}{}
+		newNodes[node.Name] = node
+	}
+
+	for name := range addrChangedNodes(old, newNodes, factory.portDiff) {
+		delete(oldNameSet, name)
 	}
 
 	result := &clientConns{}
 	result.conns = make([]*clientConn, 0, len(old.conns))
 	for _, conn := range old.conns {
-		_, existed := newNameSet[conn.nodeName]
-		if !existed {
-			releaseAndClose(conn)
+		node, existed := newNodes[conn.nodeName]
+		_, kept := oldNameSet[conn.nodeName]
+		if !existed || !kept {
+			removeClientConn(conn, factory.drainTimeout)
 			continue
 		}
 
+		conn.setLoad(node.Load)
 		result.conns = append(result.conns, conn)
 	}
 
+	var connErrors []nodeConnError
 	for _, node := range nodes {
 		_, existed := oldNameSet[node.Name]
 		if existed {
 			continue
 		}
 
-		result.conns = append(result.conns, &clientConn{
-			conn:     dial(getGRPCAddrFromMemberlist(node.Addr, portDiff)),
-			nodeName: node.Name,
-			refCount: 1,
-		})
+		conns, err := factory.newNodeConns(node)
+		if err != nil {
+			connErrors = append(connErrors, nodeConnError{nodeName: node.Name, addr: node.Addr, err: err})
+			continue
+		}
+		result.conns = append(result.conns, conns...)
 	}
 
-	return result
+	return result, connErrors
 }
@@ -0,0 +1,88 @@
+package goblin
+
+import (
+	"context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// poolClientConn adapts PoolClient to grpc.ClientConnInterface
+type poolClientConn struct {
+	client *PoolClient
+}
+
+var _ grpc.ClientConnInterface = poolClientConn{}
+
+// ClientConn returns a grpc.ClientConnInterface that can be passed to generated NewXxxClient constructors.
+// Each unary call picks a pooled connection, each stream pins its connection for the lifetime of the stream
+func (c *PoolClient) ClientConn() grpc.ClientConnInterface {
+	return poolClientConn{client: c}
+}
+
+func (p poolClientConn) Invoke(
+	ctx context.Context, method string, args interface{}, reply interface{}, opts ...grpc.CallOption,
+) error {
+	err := p.client.GetConn(func(conn *grpc.ClientConn) error {
+		return conn.Invoke(ctx, method, args, reply, opts...)
+	})
+	return toStatusError(err)
+}
+
+// toStatusError converts the errors of the pool to gRPC status errors, as expected by generated clients
+func toStatusError(err error) error {
+	switch err {
+	case ErrNoConn, ErrClosed, ErrCircuitOpen:
+		return status.Error(codes.Unavailable, err.Error())
+	case ErrOverloaded:
+		return status.Error(codes.ResourceExhausted, err.Error())
+	default:
+		return err
+	}
+}
+
+// NewStream the stream finishes when the context is done or RecvMsg returns an error
+// (or returns the response of a non server streaming method), same as the contract of grpc.ClientConn
+func (p poolClientConn) NewStream(
+	ctx context.Context, desc *grpc.StreamDesc, method string, opts ...grpc.CallOption,
+) (grpc.ClientStream, error) {
+	lease, err := p.client.Lease()
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	stream, err := lease.NewStream(ctx, desc, method, opts...)
+	if err != nil {
+		cancel()
+		lease.Release()
+		return nil, err
+	}
+
+	go func() {
+		<-ctx.Done()
+		lease.Release()
+	}()
+
+	return &leasedStream{
+		ClientStream: stream,
+		desc:         desc,
+		cancel:       cancel,
+	}, nil
+}
+
+// leasedStream releases its lease when RecvMsg returns an error, or the single response
+// of a non server streaming method
+type leasedStream struct {
+	grpc.ClientStream
+	desc   *grpc.StreamDesc
+	cancel func()
+}
+
+func (s *leasedStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err != nil || !s.desc.ServerStreams {
+		s.cancel()
+	}
+	return err
+}
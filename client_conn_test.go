@@ -0,0 +1,152 @@
+package goblin
+
+import (
+	"context"
+	"github.com/QuangTung97/goblin/goblinpb"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+type fakeGoblinServer struct {
+	goblinpb.UnimplementedGoblinServiceServer
+}
+
+func (fakeGoblinServer) GetNode(context.Context, *goblinpb.GetNodeRequest) (*goblinpb.GetNodeResponse, error) {
+	return &goblinpb.GetNodeResponse{Name: "name-1", Addr: "address-1"}, nil
+}
+
+func (fakeGoblinServer) Watch(_ *goblinpb.WatchRequest, stream goblinpb.GoblinService_WatchServer) error {
+	return stream.Send(&goblinpb.NodeList{Seq: 1})
+}
+
+func (fakeGoblinServer) WatchShardMap(
+	_ *goblinpb.WatchShardMapRequest, stream goblinpb.GoblinService_WatchShardMapServer,
+) error {
+	return stream.Send(&goblinpb.ShardMap{Seq: 1, Nodes: []string{"name-1"}, Owners: []uint32{0, 0}})
+}
+
+func startFakeGoblinServer(t *testing.T) string {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Equal(t, nil, err)
+
+	s := grpc.NewServer()
+	goblinpb.RegisterGoblinServiceServer(s, fakeGoblinServer{})
+	go func() {
+		_ = s.Serve(lis)
+	}()
+	t.Cleanup(s.Stop)
+
+	return lis.Addr().String()
+}
+
+func newFakeServerPoolClient(t *testing.T) (*PoolClient, *clientConn) {
+	addr := startFakeGoblinServer(t)
+	cc, err := grpc.Dial(addr, grpc.WithInsecure())
+	assert.Equal(t, nil, err)
+
+	conn := &clientConn{
+		conn:     unsafe.Pointer(cc),
+		nodeName: "name-1",
+		addr:     addr,
+		refCount: 1,
+		state:    newConnState(),
+	}
+	pool := makePoolClient(ClientConfig{})
+	pool.setClientConns(&clientConns{
+		conns: []*clientConn{conn},
+	})
+	return pool, conn
+}
+
+func TestPoolClient_ClientConn_Invoke(t *testing.T) {
+	pool, conn := newFakeServerPoolClient(t)
+	client := goblinpb.NewGoblinServiceClient(pool.ClientConn())
+
+	resp, err := client.GetNode(context.Background(), &goblinpb.GetNodeRequest{})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "name-1", resp.Name)
+	assert.Equal(t, uint64(1), atomic.LoadUint64(&conn.refCount))
+}
+
+func TestPoolClient_ClientConn_NewStream(t *testing.T) {
+	pool, conn := newFakeServerPoolClient(t)
+	client := goblinpb.NewGoblinServiceClient(pool.ClientConn())
+
+	stream, err := client.Watch(context.Background(), &goblinpb.WatchRequest{})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, uint64(2), atomic.LoadUint64(&conn.refCount))
+
+	nodeList, err := stream.Recv()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, uint64(1), nodeList.Seq)
+
+	_, err = stream.Recv()
+	assert.Equal(t, io.EOF, err)
+
+	assert.Eventually(t, func() bool {
+		return atomic.LoadUint64(&conn.refCount) == 1
+	}, time.Second, time.Millisecond)
+}
+
+func TestPoolClient_ClientConn_NewStream_Cancel(t *testing.T) {
+	pool, conn := newFakeServerPoolClient(t)
+	client := goblinpb.NewGoblinServiceClient(pool.ClientConn())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err := client.Watch(ctx, &goblinpb.WatchRequest{})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, uint64(2), atomic.LoadUint64(&conn.refCount))
+
+	cancel()
+	assert.Eventually(t, func() bool {
+		return atomic.LoadUint64(&conn.refCount) == 1
+	}, time.Second, time.Millisecond)
+}
+
+func TestPoolClient_ClientConn_No_Conn(t *testing.T) {
+	pool := makePoolClient(ClientConfig{})
+	client := goblinpb.NewGoblinServiceClient(pool.ClientConn())
+
+	_, err := client.GetNode(context.Background(), &goblinpb.GetNodeRequest{})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+
+	_, err = client.Watch(context.Background(), &goblinpb.WatchRequest{})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+}
+
+func TestToStatusError(t *testing.T) {
+	assert.Equal(t, codes.Unavailable, status.Code(toStatusError(ErrNoConn)))
+	assert.Equal(t, codes.Unavailable, status.Code(toStatusError(ErrClosed)))
+	assert.Equal(t, codes.Unavailable, status.Code(toStatusError(ErrCircuitOpen)))
+	assert.Equal(t, codes.ResourceExhausted, status.Code(toStatusError(ErrOverloaded)))
+	assert.Equal(t, nil, toStatusError(nil))
+	assert.Equal(t, io.EOF, toStatusError(io.EOF))
+}
+
+func TestPoolClient_ClientConn_NewStream_Not_Server_Streaming(t *testing.T) {
+	pool, conn := newFakeServerPoolClient(t)
+
+	desc := &grpc.StreamDesc{StreamName: "GetNode"}
+	stream, err := pool.ClientConn().NewStream(context.Background(), desc, "/goblin.GoblinService/GetNode")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, uint64(2), atomic.LoadUint64(&conn.refCount))
+
+	assert.Equal(t, nil, stream.SendMsg(&goblinpb.GetNodeRequest{}))
+	assert.Equal(t, nil, stream.CloseSend())
+
+	resp := &goblinpb.GetNodeResponse{}
+	assert.Equal(t, nil, stream.RecvMsg(resp))
+	assert.Equal(t, "name-1", resp.Name)
+
+	assert.Eventually(t, func() bool {
+		return atomic.LoadUint64(&conn.refCount) == 1
+	}, time.Second, time.Millisecond)
+}
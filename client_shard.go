@@ -0,0 +1,173 @@
+package goblin
+
+import (
+	"errors"
+	"github.com/QuangTung97/goblin/goblinpb"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"io"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+// ErrNoShardMap when the shard map has not been received, see WithShardRouting
+var ErrNoShardMap = errors.New("shard map is not available")
+
+// clientShardMap is the owner name of each shard (indexed by shard)
+type clientShardMap struct {
+	owners []string
+}
+
+func (c *PoolClient) getShardMap() *clientShardMap {
+	return (*clientShardMap)(atomic.LoadPointer(&c.shards))
+}
+
+func (c *PoolClient) setShardMap(m *clientShardMap) {
+	atomic.StorePointer(&c.shards, unsafe.Pointer(m))
+}
+
+// GetShardMap returns the owner name of each shard (indexed by shard), nil if not received yet.
+// The slice must not be modified
+func (c *PoolClient) GetShardMap() []string {
+	m := c.getShardMap()
+	if m == nil {
+		return nil
+	}
+	return m.owners
+}
+
+// findConnByName balances between sub-connections of the node
+func (c *PoolClient) findConnByName(name string) *clientConn {
+	tmp := c.getClientConns()
+	if tmp == nil {
+		return nil
+	}
+
+	count := uint64(0)
+	for _, conn := range tmp.conns {
+		if conn.nodeName == name {
+			count++
+		}
+	}
+	if count == 0 {
+		return nil
+	}
+
+	index := atomic.AddUint64(&c.seq, 1) % count
+	for _, conn := range tmp.conns {
+		if conn.nodeName != name {
+			continue
+		}
+		if index == 0 {
+			return conn
+		}
+		index--
+	}
+	return nil
+}
+
+func (c *PoolClient) acquireConnByName(name string) (*clientConn, error) {
+	if c.globalOverloaded() {
+		return nil, ErrOverloaded
+	}
+
+	for {
+		if c.isClosed() {
+			return nil, ErrClosed
+		}
+
+		conn := c.findConnByName(name)
+		if conn == nil {
+			return nil, ErrNoConn
+		}
+
+		ok, saturated, open := c.tryAcquireConn(conn)
+		if saturated {
+			return nil, ErrOverloaded
+		}
+		if open {
+			return nil, ErrCircuitOpen
+		}
+		if ok {
+			return conn, nil
+		}
+	}
+}
+
+// GetConnByName is like GetConn but for a specific node, returns ErrNoConn if the node is not in the pool
+// and ErrCircuitOpen if its circuit breaker rejects the request
+func (c *PoolClient) GetConnByName(name string, fn func(conn *grpc.ClientConn) error) error {
+	conn, err := c.acquireConnByName(name)
+	if err != nil {
+		return err
+	}
+	return c.doRequestConn(conn, fn, false)
+}
+
+// GetConnForKey is like GetConn but for the owner of the shard of key (see ShardForKey),
+// requires WithShardRouting. Returns ErrNoShardMap if the shard map is not received or empty
+func (c *PoolClient) GetConnForKey(key string, fn func(conn *grpc.ClientConn) error) error {
+	m := c.getShardMap()
+	if m == nil || len(m.owners) == 0 {
+		return ErrNoShardMap
+	}
+
+	owner := m.owners[ShardForKey(key, len(m.owners))]
+	return c.GetConnByName(owner, fn)
+}
+
+// watchShardMapSingleLoop returns true if it received at least one shard map
+func (c *PoolClient) watchShardMapSingleLoop() bool {
+	logger := c.options.logger
+
+	client := goblinpb.NewGoblinServiceClient(c.ClientConn())
+	stream, err := client.WatchShardMap(c.ctx, &goblinpb.WatchShardMapRequest{})
+	if err != nil {
+		logger.Warn("watch shard map", zap.Error(err))
+		return false
+	}
+
+	received := false
+	for {
+		shardMap, err := stream.Recv()
+		if err == io.EOF {
+			return received
+		}
+		if err != nil {
+			if c.ctx.Err() == nil {
+				logger.Error("receive shard map", zap.Error(err))
+			}
+			return received
+		}
+
+		owners := shardMapFromProto(shardMap)
+		if owners == nil {
+			logger.Error("invalid shard map", zap.Uint64("seq", shardMap.Seq))
+			continue
+		}
+
+		received = true
+		c.setShardMap(&clientShardMap{owners: owners})
+	}
+}
+
+// watchShardMap watches through the pool connections
+func (c *PoolClient) watchShardMap() {
+	defer c.wg.Done()
+
+	b := newBackoff(c.options.watchRetryMin, c.options.watchRetry)
+	for c.ctx.Err() == nil {
+		// an empty pool is not a failure, the shard map is watched as soon as nodes are known
+		if c.WaitReady(c.ctx) != nil {
+			return
+		}
+
+		start := time.Now()
+		received := c.watchShardMapSingleLoop()
+		if received && time.Since(start) >= minHealthyWatchTime {
+			b.reset()
+		}
+		c.sleep(b.next())
+	}
+}
@@ -0,0 +1,91 @@
+package goblin
+
+import (
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"testing"
+	"time"
+)
+
+func TestPoolClient_FindConnByName(t *testing.T) {
+	conn1 := &clientConn{nodeName: "name-1", refCount: 1}
+	conn2 := &clientConn{nodeName: "name-2", refCount: 1}
+	conn3 := &clientConn{nodeName: "name-2", refCount: 1}
+
+	pool := makePoolClient(ClientConfig{})
+	assert.Equal(t, (*clientConn)(nil), pool.findConnByName("name-1"))
+
+	pool.setClientConns(&clientConns{conns: []*clientConn{conn1, conn2, conn3}})
+	assert.Same(t, conn1, pool.findConnByName("name-1"))
+	assert.Same(t, conn2, pool.findConnByName("name-2"))
+	assert.Same(t, conn3, pool.findConnByName("name-2"))
+	assert.Equal(t, (*clientConn)(nil), pool.findConnByName("name-3"))
+}
+
+func TestPoolClient_GetConnByName(t *testing.T) {
+	pool, conn := newFakeServerPoolClient(t)
+
+	err := pool.GetConnByName("name-1", func(cc *grpc.ClientConn) error {
+		assert.Same(t, conn.getConn(), cc)
+		assert.Equal(t, uint64(2), conn.refCount)
+		return nil
+	})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, uint64(1), conn.refCount)
+
+	err = pool.GetConnByName("name-2", func(cc *grpc.ClientConn) error {
+		return nil
+	})
+	assert.Equal(t, ErrNoConn, err)
+}
+
+func TestPoolClient_GetConnForKey(t *testing.T) {
+	pool, conn := newFakeServerPoolClient(t)
+
+	err := pool.GetConnForKey("key-1", func(cc *grpc.ClientConn) error {
+		return nil
+	})
+	assert.Equal(t, ErrNoShardMap, err)
+
+	received := pool.watchShardMapSingleLoop()
+	assert.Equal(t, true, received)
+	assert.Equal(t, []string{"name-1", "name-1"}, pool.GetShardMap())
+
+	called := false
+	err = pool.GetConnForKey("key-1", func(cc *grpc.ClientConn) error {
+		called = true
+		assert.Same(t, conn.getConn(), cc)
+		return nil
+	})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, called)
+
+	pool.setShardMap(&clientShardMap{owners: []string{"name-2"}})
+	err = pool.GetConnForKey("key-1", func(cc *grpc.ClientConn) error {
+		return nil
+	})
+	assert.Equal(t, ErrNoConn, err)
+}
+
+func TestPoolClient_WatchShardMap_Waits_For_Conns(t *testing.T) {
+	pool, _ := newFakeServerPoolClient(t)
+	pool.options.watchRetryMin = time.Second
+
+	conns := pool.getClientConns()
+	pool.setClientConns(&clientConns{})
+
+	pool.wg.Add(1)
+	go pool.watchShardMap()
+	defer func() {
+		pool.cancel()
+		pool.wg.Wait()
+	}()
+
+	// the empty pool does not increase the backoff
+	time.Sleep(50 * time.Millisecond)
+	pool.setClientConns(conns)
+
+	assert.Eventually(t, func() bool {
+		return pool.getShardMap() != nil
+	}, 300*time.Millisecond, time.Millisecond)
+}
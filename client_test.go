@@ -1,10 +1,14 @@
 package goblin
 
 import (
+	"context"
+	"errors"
 	"github.com/QuangTung97/goblin/goblinpb"
 	"github.com/stretchr/testify/assert"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
 	"testing"
+	"time"
 	"unsafe"
 )
 
@@ -99,30 +103,75 @@ func TestPoolClient_GetNextConn_Conns_Empty(t *testing.T) {
 
 func TestGetGRPCAddrFromMemberlistAddr(t *testing.T) {
 	t.Run("not-contains-colon", func(t *testing.T) {
-		assert.PanicsWithValue(t, "invalid address", func() {
-			getGRPCAddrFromMemberlist("some-host-1", 200)
-		})
+		result, err := getGRPCAddrFromMemberlist("some-host-1", 200)
+		assert.Equal(t, ErrInvalidAddress, err)
+		assert.Equal(t, "", result)
 	})
 
 	t.Run("not-number", func(t *testing.T) {
-		assert.Panics(t, func() {
-			getGRPCAddrFromMemberlist("some-host-1:string", 200)
-		})
+		result, err := getGRPCAddrFromMemberlist("some-host-1:string", 200)
+		assert.Equal(t, ErrInvalidAddress, err)
+		assert.Equal(t, "", result)
+	})
+
+	t.Run("port-too-small", func(t *testing.T) {
+		_, err := getGRPCAddrFromMemberlist("some-host-1:100", 200)
+		assert.Equal(t, ErrInvalidAddress, err)
 	})
 
 	t.Run("normal", func(t *testing.T) {
-		result := getGRPCAddrFromMemberlist("some-host-1:5800", 200)
+		result, err := getGRPCAddrFromMemberlist("some-host-1:5800", 200)
+		assert.Equal(t, nil, err)
 		assert.Equal(t, "some-host-1:5600", result)
 	})
+
+	t.Run("ipv6", func(t *testing.T) {
+		result, err := getGRPCAddrFromMemberlist("[fd00::2]:5800", 200)
+		assert.Equal(t, nil, err)
+		assert.Equal(t, "[fd00::2]:5600", result)
+	})
+
+	t.Run("ipv6-without-brackets", func(t *testing.T) {
+		result, err := getGRPCAddrFromMemberlist("fd00::2:5800", 200)
+		assert.Equal(t, nil, err)
+		assert.Equal(t, "[fd00::2]:5600", result)
+	})
+}
+
+// withoutConnState clears the connState for comparing
+func withoutConnState(conns []*clientConn) []*clientConn {
+	result := make([]*clientConn, 0, len(conns))
+	for _, conn := range conns {
+		if conn.state == nil {
+			result = append(result, conn)
+			continue
+		}
+		result = append(result, &clientConn{
+			conn:     conn.conn,
+			nodeName: conn.nodeName,
+			addr:     conn.addr,
+			refCount: conn.refCount,
+		})
+	}
+	return result
+}
+
+func newTestConnFactory(dial func(addr string) (*grpc.ClientConn, error)) connFactory {
+	return connFactory{
+		portDiff: 200,
+		dial:     dial,
+	}
 }
 
 func TestComputeNewClientConns(t *testing.T) {
 	conn1 := &clientConn{
 		nodeName: "name-1",
+		addr:     "some-host-1:5600",
 		refCount: 10,
 	}
 	conn2 := &clientConn{
 		nodeName: "name-2",
+		addr:     "some-host-2:5600",
 		refCount: 20,
 	}
 
@@ -149,11 +198,12 @@ func TestComputeNewClientConns(t *testing.T) {
 
 	var dialAddr string
 	var dialCount int
-	result := computeNewClientConns(old, nodes, 200, func(addr string) *grpc.ClientConn {
+	result, connErrors := computeNewClientConns(old, nodes, newTestConnFactory(func(addr string) (*grpc.ClientConn, error) {
 		dialCount++
 		dialAddr = addr
-		return nil
-	})
+		return nil, nil
+	}))
+	assert.Equal(t, []nodeConnError(nil), connErrors)
 
 	assert.NotNil(t, result)
 	if result == old {
@@ -165,17 +215,53 @@ func TestComputeNewClientConns(t *testing.T) {
 		conn1,
 		{
 			nodeName: "name-3",
+			addr:     "some-host-3:5600",
 			refCount: 1,
 		},
 		{
 			nodeName: "name-4",
+			addr:     "some-host-4:5600",
 			refCount: 1,
 		},
-	}, result.conns)
+	}, withoutConnState(result.conns))
 
 	assert.Equal(t, uint64(19), conn2.refCount)
 }
 
+func TestComputeNewClientConns_Addr_Changed(t *testing.T) {
+	conn1 := &clientConn{
+		nodeName: "name-1",
+		addr:     "some-host-1:5600",
+		refCount: 10,
+	}
+	conn2 := &clientConn{
+		nodeName: "name-2",
+		addr:     "some-host-2:5600",
+		refCount: 20,
+	}
+	old := &clientConns{conns: []*clientConn{conn1, conn2}}
+
+	nodes := []*goblinpb.Node{
+		{Name: "name-1", Addr: "some-host-1:5800"},
+		{Name: "name-2", Addr: "other-host-2:5800"},
+	}
+
+	var dialAddrs []string
+	result, connErrors := computeNewClientConns(old, nodes, newTestConnFactory(func(addr string) (*grpc.ClientConn, error) {
+		dialAddrs = append(dialAddrs, addr)
+		return nil, nil
+	}))
+	assert.Equal(t, []nodeConnError(nil), connErrors)
+	assert.Equal(t, []string{"other-host-2:5600"}, dialAddrs)
+	assert.Equal(t, []*clientConn{
+		conn1,
+		{nodeName: "name-2", addr: "other-host-2:5600", refCount: 1},
+	}, withoutConnState(result.conns))
+
+	assert.Equal(t, uint64(10), conn1.refCount)
+	assert.Equal(t, uint64(19), conn2.refCount)
+}
+
 func TestComputeNewClientConns_Old_Conns_Nil(t *testing.T) {
 	nodes := []*goblinpb.Node{
 		{
@@ -194,26 +280,556 @@ func TestComputeNewClientConns_Old_Conns_Nil(t *testing.T) {
 
 	var dialAddr string
 	var dialCount int
-	result := computeNewClientConns(nil, nodes, 200, func(addr string) *grpc.ClientConn {
+	result, connErrors := computeNewClientConns(nil, nodes, newTestConnFactory(func(addr string) (*grpc.ClientConn, error) {
 		dialCount++
 		dialAddr = addr
-		return nil
-	})
+		return nil, nil
+	}))
+	assert.Equal(t, []nodeConnError(nil), connErrors)
 
 	assert.Equal(t, 3, dialCount)
 	assert.Equal(t, "some-host-4:5600", dialAddr)
 	assert.Equal(t, []*clientConn{
 		{
 			nodeName: "name-1",
+			addr:     "some-host-1:5600",
 			refCount: 1,
 		},
 		{
 			nodeName: "name-3",
+			addr:     "some-host-3:5600",
 			refCount: 1,
 		},
 		{
 			nodeName: "name-4",
+			addr:     "some-host-4:5600",
 			refCount: 1,
 		},
-	}, result.conns)
+	}, withoutConnState(result.conns))
+}
+
+func TestNodeGRPCAddr(t *testing.T) {
+	addr, err := nodeGRPCAddr(&goblinpb.Node{Addr: "some-host-1:5800"}, 200)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "some-host-1:5600", addr)
+
+	addr, err = nodeGRPCAddr(&goblinpb.Node{Addr: "some-host-1:5800", GrpcAddr: "other-host:4001"}, 200)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "other-host:4001", addr)
+
+	_, err = nodeGRPCAddr(&goblinpb.Node{Addr: "some-host-1"}, 200)
+	assert.Equal(t, ErrInvalidAddress, err)
+}
+
+func TestComputeNewClientConns_Advertised_GRPCAddr(t *testing.T) {
+	nodes := []*goblinpb.Node{
+		{Name: "name-1", Addr: "some-host-1:5800", GrpcAddr: "public-host-1:31001"},
+		{Name: "name-2", Addr: "some-host-2:5800"},
+	}
+
+	var dialAddrs []string
+	result, connErrors := computeNewClientConns(nil, nodes, newTestConnFactory(func(addr string) (*grpc.ClientConn, error) {
+		dialAddrs = append(dialAddrs, addr)
+		return nil, nil
+	}))
+	assert.Equal(t, []nodeConnError(nil), connErrors)
+	assert.Equal(t, []string{"public-host-1:31001", "some-host-2:5600"}, dialAddrs)
+	assert.Equal(t, []*clientConn{
+		{nodeName: "name-1", addr: "public-host-1:31001", refCount: 1},
+		{nodeName: "name-2", addr: "some-host-2:5600", refCount: 1},
+	}, withoutConnState(result.conns))
+}
+
+func TestComputeNewClientConns_Skip_Errors(t *testing.T) {
+	nodes := []*goblinpb.Node{
+		{
+			Name: "name-1",
+			Addr: "some-host-1",
+		},
+		{
+			Name: "name-2",
+			Addr: "some-host-2:5800",
+		},
+		{
+			Name: "name-3",
+			Addr: "some-host-3:5800",
+		},
+	}
+
+	dialErr := errors.New("dial error")
+	result, connErrors := computeNewClientConns(nil, nodes, newTestConnFactory(func(addr string) (*grpc.ClientConn, error) {
+		if addr == "some-host-2:5600" {
+			return nil, dialErr
+		}
+		return nil, nil
+	}))
+
+	assert.Equal(t, []nodeConnError{
+		{nodeName: "name-1", addr: "some-host-1", err: ErrInvalidAddress},
+		{nodeName: "name-2", addr: "some-host-2:5800", err: dialErr},
+	}, connErrors)
+	assert.Equal(t, []*clientConn{
+		{
+			nodeName: "name-3",
+			addr:     "some-host-3:5600",
+			refCount: 1,
+		},
+	}, withoutConnState(result.conns))
+}
+
+func TestComputeNewClientConns_Lazy_Connect(t *testing.T) {
+	nodes := []*goblinpb.Node{
+		{
+			Name: "name-1",
+			Addr: "127.0.0.1:5800",
+		},
+	}
+
+	var dialAddrs []string
+	factory := newTestConnFactory(func(addr string) (*grpc.ClientConn, error) {
+		dialAddrs = append(dialAddrs, addr)
+		return grpc.Dial(addr, grpc.WithInsecure())
+	})
+	factory.lazyConnect = true
+
+	result, connErrors := computeNewClientConns(nil, nodes, factory)
+	assert.Equal(t, []nodeConnError(nil), connErrors)
+	assert.Equal(t, []string(nil), dialAddrs)
+
+	conn := result.conns[0]
+	assert.Equal(t, (*grpc.ClientConn)(nil), conn.getConn())
+
+	cc, err := conn.connect()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, cc, conn.getConn())
+
+	cc2, err := conn.connect()
+	assert.Equal(t, nil, err)
+	assert.Same(t, cc, cc2)
+	assert.Equal(t, []string{"127.0.0.1:5600"}, dialAddrs)
+
+	releaseAndClose(conn)
+}
+
+type connErrorMetricsRecorder struct {
+	NopClientMetrics
+	nodes []string
+}
+
+func (m *connErrorMetricsRecorder) NodeConnError(nodeName string, _ error) {
+	m.nodes = append(m.nodes, nodeName)
+}
+
+// failingDialAddr is a gRPC address that fails dialing
+const failingDialAddr = "dns:///[bad"
+
+func TestPoolClient_UpdateClientConns_Quarantine(t *testing.T) {
+	metrics := &connErrorMetricsRecorder{}
+	pool := makePoolClient(ClientConfig{
+		Options: []grpc.DialOption{grpc.WithInsecure()},
+	}, WithClientPortDiff(200), WithClientMetrics(metrics), WithNodeQuarantineDuration(30*time.Second))
+
+	now := mustParse("2021-06-18T09:00:00+07:00")
+	pool.getNow = func() time.Time { return now }
+
+	nodes := []*goblinpb.Node{
+		{Name: "name-1", Addr: "127.0.0.1:7001", GrpcAddr: failingDialAddr},
+		{Name: "name-2", Addr: "127.0.0.1:5800"},
+	}
+
+	pool.updateClientConnsLocked(nodes)
+	assert.Equal(t, []string{"name-2"}, getConnNodeNames(pool))
+	assert.Equal(t, []string{"name-1"}, metrics.nodes)
+	assert.Equal(t, map[string]time.Time{"name-1": now.Add(30 * time.Second)}, pool.quarantine)
+
+	// still in quarantine, not retried
+	pool.updateClientConnsLocked(nodes)
+	assert.Equal(t, []string{"name-1"}, metrics.nodes)
+
+	// quarantine expired, retried
+	now = now.Add(31 * time.Second)
+	pool.updateClientConnsLocked(nodes)
+	assert.Equal(t, []string{"name-1", "name-1"}, metrics.nodes)
+
+	// node left, quarantine removed
+	pool.updateClientConnsLocked(nodes[1:])
+	assert.Equal(t, map[string]time.Time{}, pool.quarantine)
+}
+
+func TestPoolClient_UpdateClientConns_Quarantine_Retry_On_Expire(t *testing.T) {
+	metrics := &connErrorMetricsRecorder{}
+	pool := makePoolClient(ClientConfig{
+		Options: []grpc.DialOption{grpc.WithInsecure()},
+	}, WithClientPortDiff(200), WithClientMetrics(metrics), WithNodeQuarantineDuration(20*time.Millisecond))
+	defer func() { _ = pool.Close() }()
+
+	nodes := []*goblinpb.Node{
+		{Name: "name-1", Addr: "127.0.0.1:7001", GrpcAddr: failingDialAddr},
+		{Name: "name-2", Addr: "127.0.0.1:5800"},
+	}
+
+	pool.mu.Lock()
+	pool.updateClientConnsLocked(nodes)
+	pool.mu.Unlock()
+
+	// retried without a new membership snapshot
+	time.Sleep(70 * time.Millisecond)
+
+	pool.mu.Lock()
+	assert.True(t, len(metrics.nodes) >= 2)
+	assert.Equal(t, []string{"name-2"}, getConnNodeNames(pool))
+	pool.mu.Unlock()
+
+	// node left, no more retries
+	pool.mu.Lock()
+	pool.updateClientConnsLocked(nodes[1:])
+	assert.Equal(t, (*time.Timer)(nil), pool.retryTimer)
+	pool.mu.Unlock()
+}
+
+func TestPoolClient_UpdateClientConns_Quarantine_Disabled(t *testing.T) {
+	metrics := &connErrorMetricsRecorder{}
+	pool := makePoolClient(ClientConfig{
+		Options: []grpc.DialOption{grpc.WithInsecure()},
+	}, WithClientMetrics(metrics), WithNodeQuarantineDuration(0))
+	defer func() { _ = pool.Close() }()
+
+	nodes := []*goblinpb.Node{
+		{Name: "name-1", Addr: "127.0.0.1:7001", GrpcAddr: failingDialAddr},
+	}
+
+	pool.mu.Lock()
+	pool.updateClientConnsLocked(nodes)
+	assert.Equal(t, map[string]time.Time{}, pool.quarantine)
+	assert.Equal(t, (*time.Timer)(nil), pool.retryTimer)
+	pool.mu.Unlock()
+
+	// no retry timer, retried on the next membership change
+	time.Sleep(30 * time.Millisecond)
+	pool.mu.Lock()
+	assert.Equal(t, []string{"name-1"}, metrics.nodes)
+	pool.updateClientConnsLocked(nodes)
+	assert.Equal(t, []string{"name-1", "name-1"}, metrics.nodes)
+	pool.mu.Unlock()
+}
+
+func TestPoolClient_UpdateClientConns_Invalid_Address(t *testing.T) {
+	metrics := &connErrorMetricsRecorder{}
+	pool := makePoolClient(ClientConfig{
+		Options: []grpc.DialOption{grpc.WithInsecure()},
+	}, WithClientPortDiff(200), WithClientMetrics(metrics), WithNodeQuarantineDuration(20*time.Millisecond))
+	defer func() { _ = pool.Close() }()
+
+	nodes := []*goblinpb.Node{
+		{Name: "name-1", Addr: "some-host-1"},
+	}
+
+	pool.mu.Lock()
+	pool.updateClientConnsLocked(nodes)
+	assert.Equal(t, map[string]time.Time{}, pool.quarantine)
+	assert.Equal(t, map[string]string{"name-1": "some-host-1"}, pool.invalid)
+	assert.Equal(t, (*time.Timer)(nil), pool.retryTimer)
+
+	// not retried with the same address
+	pool.updateClientConnsLocked(nodes)
+	assert.Equal(t, []string{"name-1"}, metrics.nodes)
+
+	// retried when the address changed
+	pool.updateClientConnsLocked([]*goblinpb.Node{{Name: "name-1", Addr: "127.0.0.1:5800"}})
+	assert.Equal(t, []string{"name-1"}, getConnNodeNames(pool))
+	assert.Equal(t, map[string]string{}, pool.invalid)
+	pool.mu.Unlock()
+}
+
+func TestWithNodeQuarantineDuration_Minimum(t *testing.T) {
+	opts := computeClientOptions(WithNodeQuarantineDuration(time.Nanosecond))
+	assert.Equal(t, minQuarantineTime, opts.quarantineTime)
+
+	opts = computeClientOptions(WithNodeQuarantineDuration(0))
+	assert.Equal(t, time.Duration(0), opts.quarantineTime)
+}
+
+func TestRemoveClientConn_Done_And_Drain(t *testing.T) {
+	cc, err := grpc.Dial("127.0.0.1:5600", grpc.WithInsecure())
+	assert.Equal(t, nil, err)
+
+	conn := &clientConn{
+		conn:     unsafe.Pointer(cc),
+		nodeName: "name-1",
+		refCount: 1,
+		state:    newConnState(),
+	}
+	done := conn.doneChan()
+
+	ok := conn.acquire()
+	assert.Equal(t, true, ok)
+
+	removeClientConn(conn, 20*time.Millisecond)
+
+	select {
+	case <-done:
+	default:
+		t.Error("done must be closed")
+	}
+	assert.Equal(t, uint64(1), conn.refCount)
+	assert.NotEqual(t, connectivity.Shutdown, cc.GetState())
+
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, connectivity.Shutdown, cc.GetState())
+
+	// release after force-closed
+	releaseAndClose(conn)
+	assert.Equal(t, uint64(0), conn.refCount)
+}
+
+func TestPoolClient_GetConnStream(t *testing.T) {
+	state := newConnState()
+	pool := makePoolClient(ClientConfig{})
+	pool.setClientConns(&clientConns{
+		conns: []*clientConn{
+			{nodeName: "name-1", refCount: 1, state: state},
+		},
+	})
+
+	var done <-chan struct{}
+	err := pool.GetConnStream(func(conn *grpc.ClientConn, d <-chan struct{}) error {
+		done = d
+		return nil
+	})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, (<-chan struct{})(state.done), done)
+}
+
+func TestComputeNewClientConns_Conns_Per_Node(t *testing.T) {
+	nodes := []*goblinpb.Node{
+		{
+			Name: "name-1",
+			Addr: "some-host-1:5800",
+		},
+		{
+			Name: "name-2",
+			Addr: "some-host-2:5800",
+		},
+	}
+
+	var dialAddrs []string
+	factory := newTestConnFactory(func(addr string) (*grpc.ClientConn, error) {
+		dialAddrs = append(dialAddrs, addr)
+		return nil, nil
+	})
+	factory.connsPerNode = 2
+
+	result, connErrors := computeNewClientConns(nil, nodes, factory)
+	assert.Equal(t, []nodeConnError(nil), connErrors)
+	assert.Equal(t, []string{
+		"some-host-1:5600", "some-host-1:5600",
+		"some-host-2:5600", "some-host-2:5600",
+	}, dialAddrs)
+	assert.Equal(t, []*clientConn{
+		{nodeName: "name-1", addr: "some-host-1:5600", refCount: 1},
+		{nodeName: "name-1", addr: "some-host-1:5600", refCount: 1},
+		{nodeName: "name-2", addr: "some-host-2:5600", refCount: 1},
+		{nodeName: "name-2", addr: "some-host-2:5600", refCount: 1},
+	}, withoutConnState(result.conns))
+
+	old := result.conns
+	result, connErrors = computeNewClientConns(result, nodes[1:], factory)
+	assert.Equal(t, []nodeConnError(nil), connErrors)
+	assert.Equal(t, old[2:], result.conns)
+	assert.Equal(t, uint64(0), old[0].refCount)
+	assert.Equal(t, uint64(0), old[1].refCount)
+}
+
+func TestComputeNewClientConns_Conns_Per_Node_Partial_Error(t *testing.T) {
+	nodes := []*goblinpb.Node{
+		{
+			Name: "name-1",
+			Addr: "some-host-1:5800",
+		},
+	}
+
+	dialErr := errors.New("dial error")
+	dialCount := 0
+	factory := newTestConnFactory(func(addr string) (*grpc.ClientConn, error) {
+		dialCount++
+		if dialCount == 2 {
+			return nil, dialErr
+		}
+		return nil, nil
+	})
+	factory.connsPerNode = 3
+
+	result, connErrors := computeNewClientConns(nil, nodes, factory)
+	assert.Equal(t, []nodeConnError{{nodeName: "name-1", addr: "some-host-1:5800", err: dialErr}}, connErrors)
+	assert.Equal(t, []*clientConn{}, result.conns)
+	assert.Equal(t, 2, dialCount)
+}
+
+func newTestDialedClientConn(t *testing.T, nodeName string) (*clientConn, *grpc.ClientConn) {
+	cc, err := grpc.Dial("127.0.0.1:5600", grpc.WithInsecure())
+	assert.Equal(t, nil, err)
+	return &clientConn{
+		conn:     unsafe.Pointer(cc),
+		nodeName: nodeName,
+		refCount: 1,
+		state:    newConnState(),
+	}, cc
+}
+
+func TestPoolClient_Close(t *testing.T) {
+	conn, cc := newTestDialedClientConn(t, "name-1")
+	pool := makePoolClient(ClientConfig{})
+	pool.setClientConns(&clientConns{
+		conns: []*clientConn{conn},
+	})
+
+	err := pool.Close()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, connectivity.Shutdown, cc.GetState())
+
+	err = pool.GetConn(func(conn *grpc.ClientConn) error { return nil })
+	assert.Equal(t, ErrClosed, err)
+
+	_, err = pool.Lease()
+	assert.Equal(t, ErrClosed, err)
+
+	err = pool.Close()
+	assert.Equal(t, nil, err)
+}
+
+func TestPoolClient_Close_Wait_In_Flight(t *testing.T) {
+	conn, cc := newTestDialedClientConn(t, "name-1")
+	pool := makePoolClient(ClientConfig{})
+	pool.setClientConns(&clientConns{
+		conns: []*clientConn{conn},
+	})
+
+	started := make(chan struct{})
+	finish := make(chan struct{})
+	go func() {
+		_ = pool.GetConn(func(conn *grpc.ClientConn) error {
+			close(started)
+			<-finish
+			return nil
+		})
+	}()
+	<-started
+
+	closed := make(chan struct{})
+	go func() {
+		_ = pool.Close()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+		t.Error("must wait for in-flight request")
+	case <-time.After(20 * time.Millisecond):
+	}
+	assert.NotEqual(t, connectivity.Shutdown, cc.GetState())
+
+	close(finish)
+	<-closed
+	assert.Equal(t, connectivity.Shutdown, cc.GetState())
+}
+
+func TestPoolClient_Close_Timeout(t *testing.T) {
+	conn, cc := newTestDialedClientConn(t, "name-1")
+	pool := makePoolClient(ClientConfig{}, WithCloseTimeout(20*time.Millisecond))
+	pool.setClientConns(&clientConns{
+		conns: []*clientConn{conn},
+	})
+
+	lease, err := pool.Lease()
+	assert.Equal(t, nil, err)
+
+	start := time.Now()
+	err = pool.Close()
+	assert.Equal(t, nil, err)
+	assert.GreaterOrEqual(t, int64(time.Since(start)), int64(20*time.Millisecond))
+	assert.Equal(t, connectivity.Shutdown, cc.GetState())
+
+	lease.Release()
+	assert.Equal(t, uint64(0), conn.refCount)
+}
+
+func TestNewPoolClient_Close_Stop_Watching(t *testing.T) {
+	pool := NewPoolClient(ClientConfig{
+		Addresses: []string{getClosedPortAddr(t, 0)},
+		Options:   []grpc.DialOption{grpc.WithInsecure()},
+	}, WithWatchBackoff(time.Hour, time.Hour), WithStalenessTTL(time.Hour))
+
+	time.Sleep(10 * time.Millisecond)
+
+	closed := make(chan struct{})
+	go func() {
+		_ = pool.Close()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Error("close must not wait for retry duration")
+	}
+}
+
+func TestPoolClient_WaitReady(t *testing.T) {
+	pool := makePoolClient(ClientConfig{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := pool.WaitReady(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		pool.setClientConns(&clientConns{})
+		time.Sleep(10 * time.Millisecond)
+		pool.setClientConns(&clientConns{
+			conns: []*clientConn{{nodeName: "name-1", refCount: 1}},
+		})
+	}()
+
+	err = pool.WaitReady(context.Background())
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, pool.Ready())
+}
+
+func TestPoolClient_WaitReady_Closed(t *testing.T) {
+	pool := makePoolClient(ClientConfig{})
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		_ = pool.Close()
+	}()
+
+	err := pool.WaitReady(context.Background())
+	assert.Equal(t, ErrClosed, err)
+}
+
+func TestPoolClient_GetConnContext(t *testing.T) {
+	pool := makePoolClient(ClientConfig{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := pool.GetConnContext(ctx, func(conn *grpc.ClientConn) error { return nil })
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	conn := &clientConn{nodeName: "name-1", refCount: 1}
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		pool.setClientConns(&clientConns{
+			conns: []*clientConn{conn},
+		})
+	}()
+
+	calls := 0
+	err = pool.GetConnContext(context.Background(), func(conn *grpc.ClientConn) error {
+		calls++
+		return nil
+	})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, uint64(1), conn.refCount)
 }
@@ -3,59 +3,88 @@ package goblin
 import (
 	"context"
 	"errors"
-	"fmt"
 	"github.com/QuangTung97/goblin/goblinpb"
 	"github.com/google/uuid"
 	"github.com/hashicorp/memberlist"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
+	"net"
 	"strconv"
-	"strings"
+	"sync"
 	"sync/atomic"
-	"time"
+	"unsafe"
 )
 
 // ServerConfig ...
 type ServerConfig struct {
 	GRPCPort uint16
 
+	// MemberlistPort is the memberlist port, default GRPCPort + port difference (see WithServerPortDiff).
+	// The gRPC address is advertised in node metadata, so ports can be assigned independently
+	MemberlistPort uint16
+
 	IsDynamicIPs bool
-	StaticAddrs  []string
+	StaticAddrs  []string // gRPC addresses of seeds, converted to memberlist addresses by the port difference
 	ServiceAddr  string
 	DialOptions  []grpc.DialOption // for rpc get a node address using ServiceAddr
+
+	// StaticMemberlistAddrs are memberlist addresses of seeds, used as is
+	StaticMemberlistAddrs []string
+
+	// BindAddr is the IP memberlist listens on (default all interfaces)
+	BindAddr string
+
+	// AdvertiseAddr is the memberlist address given to other members, "ip" or "ip:port" (e.g. behind NAT),
+	// the port defaults to the memberlist port. Default is the first private IP (or BindAddr if set)
+	AdvertiseAddr string
+
+	// AdvertiseInterface is the network interface (e.g. eth0) whose address is advertised,
+	// can not be used with AdvertiseAddr
+	AdvertiseInterface string
+
+	// AdvertiseGRPCAddr is the gRPC address given to clients, default is the advertised IP with GRPCPort
+	AdvertiseGRPCAddr string
+
+	// NodeName is a stable name of the node, kept across restarts. If empty and DataDir is set,
+	// a generated name is persisted in DataDir, otherwise a new name is generated on every start
+	NodeName string
+	DataDir  string
 }
 
 // PoolServer a service discovery server for client connection pool
 type PoolServer struct {
-	config  ServerConfig
-	options serverOptions
-	name    string
+	config   ServerConfig
+	options  serverOptions
+	name     string
+	instance string // changed on every start, see Node.Instance
 
 	getJoinAddrs func() []string
+	seeds        unsafe.Pointer // *[]string, memberlist addresses of static seeds
+	joinRetry    int64          // time.Duration
+
+	seedsMu      sync.Mutex
+	seedLists    seedLists
+	seedsChanged chan struct{} // closed and replaced whenever seeds changed
+
+	grpcAddr string // the advertised gRPC address
 
 	m          *memberlist.Memberlist
 	broadcasts *memberlist.TransmitLimitedQueue
 
-	nodeMap *nodeMap
-	ctx     context.Context
-	cancel  func()
+	nodeMap     *nodeMap
+	broadcaster *snapshotBroadcaster
+	load        *atomicFloat64
+	messages    *messageBus
+	kv          *KVStore
+	leader      *leaderElector
 
-	ready uint32
-}
+	shards           *shardState
+	shardBroadcaster *snapshotBroadcaster
 
-func getStaticJoinAddrs(config ServerConfig, portDiff uint16) func() []string {
-	joinAddrs := make([]string, 0, len(config.StaticAddrs))
-	for _, addr := range config.StaticAddrs {
-		ip, port, err := getStaticIPAndPort(addr)
-		if err != nil {
-			panic(err)
-		}
-		joinAddrs = append(joinAddrs, fmt.Sprintf("%s:%d", ip, port+portDiff))
-	}
+	ctx    context.Context
+	cancel func()
 
-	return func() []string {
-		return joinAddrs
-	}
+	ready uint32
 }
 
 func getDynamicJoinAddrs(config ServerConfig, logger *zap.Logger) func() []string {
@@ -79,6 +108,35 @@ func getDynamicJoinAddrs(config ServerConfig, logger *zap.Logger) func() []strin
 	}
 }
 
+// newBroadcastQueue members points to the memberlist, the local node is the only member until it is set
+func newBroadcastQueue(retransmitMult int, members *unsafe.Pointer) *memberlist.TransmitLimitedQueue {
+	return &memberlist.TransmitLimitedQueue{
+		RetransmitMult: retransmitMult,
+		NumNodes: func() int {
+			m := (*memberlist.Memberlist)(atomic.LoadPointer(members))
+			if m == nil {
+				return 1
+			}
+			return m.NumMembers()
+		},
+	}
+}
+
+// newServerDelegate creates the delegate of a new instance of the node
+func newServerDelegate(
+	config ServerConfig, nodes *nodeMap, load *atomicFloat64, messages *messageBus, kv *KVStore,
+) *delegate {
+	d := newDelegate(nodes)
+	d.load = load
+	d.messages = messages
+	d.kv = kv
+	d.instance = uuid.New().String()
+	if config.AdvertiseGRPCAddr != "" {
+		d.setGRPCAddr(config.AdvertiseGRPCAddr)
+	}
+	return d
+}
+
 // NewPoolServer creates a PoolServer
 func NewPoolServer(config ServerConfig, opts ...ServerOption) (*PoolServer, error) {
 	err := validateServerConfig(config)
@@ -88,16 +146,42 @@ func NewPoolServer(config ServerConfig, opts ...ServerOption) (*PoolServer, erro
 
 	options := computeServerOptions(opts...)
 
+	seeds, staticJoinAddrs, err := initSeeds(config, options.portDiff)
+	if err != nil {
+		return nil, err
+	}
+
 	nodes := newNodeMap(options.leftNodeExpireTime)
-	name := uuid.New().String()
 
 	mconf := memberlist.DefaultLANConfig()
-	mconf.Name = name
-	mconf.BindPort = int(config.GRPCPort + options.portDiff)
+	err = configureNodeIdentity(config, mconf)
+	if err != nil {
+		return nil, err
+	}
+	err = configureMemberlistAddrs(config, mconf, options.portDiff)
+	if err != nil {
+		return nil, err
+	}
 
+	name := mconf.Name
 	options.memberlistConf(mconf)
 
-	d := newDelegate(nodes)
+	load := &atomicFloat64{}
+	if options.loadFunc != nil {
+		load.store(options.loadFunc())
+	}
+
+	messages := newMessageBus(name, mconf.UDPBufferSize-messageOverhead, options.logger)
+	kv := newKVStore(name, mconf.UDPBufferSize-messageOverhead, options.kvTombstoneTTL)
+
+	// memberlist receives messages inside Create, the broadcast queue must be wired before
+	var members unsafe.Pointer
+	broadcasts := newBroadcastQueue(mconf.RetransmitMult, &members)
+	messages.broadcasts = broadcasts
+	kv.broadcasts = broadcasts
+
+	d := newServerDelegate(config, nodes, load, messages, kv)
+	d.broadcasts = broadcasts
 	mconf.Delegate = d
 	mconf.Events = newEventDelegate(nodes)
 
@@ -105,34 +189,61 @@ func NewPoolServer(config ServerConfig, opts ...ServerOption) (*PoolServer, erro
 	if err != nil {
 		return nil, err
 	}
+	atomic.StorePointer(&members, unsafe.Pointer(m))
 
-	broadcasts := &memberlist.TransmitLimitedQueue{
-		RetransmitMult: mconf.RetransmitMult,
-		NumNodes: func() int {
-			return m.NumMembers()
-		},
-	}
+	grpcAddr := initGRPCAddr(config, m, d, options.logger)
 
-	d.broadcasts = broadcasts
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &PoolServer{
+		config:   config,
+		options:  options,
+		name:     name,
+		instance: d.instance,
+
+		joinRetry:    int64(options.joinRetryTime),
+		seedLists:    seeds,
+		seedsChanged: make(chan struct{}),
+
+		grpcAddr: grpcAddr,
+
+		m:           m,
+		broadcasts:  broadcasts,
+		nodeMap:     nodes,
+		broadcaster: newSnapshotBroadcaster(options.watchBufferSize),
+		load:        load,
+		messages:    messages,
+		kv:          kv,
+		leader:      newLeaderElector(options.leaderStabilityDelay, options.expectedMembers),
+
+		shards:           newShardState(),
+		shardBroadcaster: newSnapshotBroadcaster(options.watchBufferSize),
+
+		ctx:    ctx,
+		cancel: cancel,
+	}
 
-	getJoinAddrs := getStaticJoinAddrs(config, options.portDiff)
+	s.setSeeds(staticJoinAddrs)
+	s.getJoinAddrs = s.getSeeds
 	if config.IsDynamicIPs {
-		getJoinAddrs = getDynamicJoinAddrs(config, options.logger)
+		s.getJoinAddrs = getDynamicJoinAddrs(config, options.logger)
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
-	s := &PoolServer{
-		config:  config,
-		options: options,
-		name:    name,
-
-		getJoinAddrs: getJoinAddrs,
+	var configData []byte
+	if options.configFile != "" {
+		configData = s.reloadConfigFile(nil)
+		go s.runConfigFileWatcher(configData)
+	}
 
-		m:          m,
-		broadcasts: broadcasts,
-		nodeMap:    nodes,
-		ctx:        ctx,
-		cancel:     cancel,
+	go s.runWatchBroadcaster()
+	go messages.run(ctx)
+	go s.runLeaderElection()
+	if options.shardCount > 0 {
+		go s.runShardAssigner()
+	} else {
+		s.publishShardMap(0, nil)
+	}
+	if options.loadReportInterval > 0 {
+		go s.runLoadReporter()
 	}
 
 	if config.IsDynamicIPs {
@@ -164,6 +275,11 @@ func (s *PoolServer) GetMemberlistAddress() string {
 	return s.m.LocalNode().Address()
 }
 
+// GetGRPCAddress returns the gRPC address advertised to clients
+func (s *PoolServer) GetGRPCAddress() string {
+	return s.grpcAddr
+}
+
 // Ready returns whether joined successfully
 func (s *PoolServer) Ready() bool {
 	return atomic.LoadUint32(&s.ready) > 0
@@ -172,13 +288,18 @@ func (s *PoolServer) Ready() bool {
 // Shutdown ...
 func (s *PoolServer) Shutdown() error {
 	addr := nodeToAddr(s.m.LocalNode())
-	s.nodeMap.nodeGracefulLeave(s.name, addr)
+	s.nodeMap.nodeGracefulLeaveInstance(s.name, addr, s.instance)
 	s.broadcasts.QueueBroadcast(broadcast{
-		name: s.name,
-		addr: addr,
+		name:     s.name,
+		addr:     addr,
+		instance: s.instance,
 	})
 
 	s.cancel()
+	s.nodeMap.watcherShouldLeave()
+	s.kv.close()
+	s.shards.close()
+
 	err := s.m.Leave(0)
 	if err != nil {
 		return err
@@ -187,6 +308,35 @@ func (s *PoolServer) Shutdown() error {
 	return s.m.Shutdown()
 }
 
+func (s *PoolServer) publishNodes(seq uint64, nodes map[string]Node) {
+	msg, err := encodeNodeList(seq, nodes)
+	if err != nil {
+		s.options.logger.Error("encodeNodeList", zap.Error(err))
+		return
+	}
+	s.broadcaster.publish(msg)
+}
+
+// runWatchBroadcaster encodes each membership snapshot once for all Watch streams
+func (s *PoolServer) runWatchBroadcaster() {
+	seq, nodes := s.nodeMap.getNodes()
+	s.publishNodes(seq, nodes)
+
+	for {
+		var newNodes map[string]Node
+		seq, newNodes = s.nodeMap.watchNodes(seq)
+		if s.ctx.Err() != nil {
+			return
+		}
+		if nodeMapSame(nodes, newNodes) {
+			continue
+		}
+
+		nodes = newNodes
+		s.publishNodes(seq, nodes)
+	}
+}
+
 func (s *PoolServer) joinIfNetworkPartition() {
 	seq, _ := s.nodeMap.getNodes()
 
@@ -195,12 +345,14 @@ func (s *PoolServer) joinIfNetworkPartition() {
 			return
 		}
 
+		changed := s.seedsChangedChan()
+
 		var addrs []string
 		seq, addrs = s.nodeMap.getNotJoinedAddresses(s.getJoinAddrs())
 		if len(addrs) == 0 {
 			atomic.StoreUint32(&s.ready, 1)
 			seq, _ = s.nodeMap.watchNodes(seq)
-			time.Sleep(s.options.joinRetryTime)
+			s.sleepJoinRetry(changed)
 			continue
 		}
 
@@ -208,7 +360,7 @@ func (s *PoolServer) joinIfNetworkPartition() {
 		atomic.StoreUint32(&s.ready, 1)
 		if err != nil {
 			s.options.logger.Error("Join error", zap.Error(err))
-			time.Sleep(s.options.joinRetryTime)
+			s.sleepJoinRetry(changed)
 			continue
 		}
 
@@ -226,7 +378,7 @@ func (s *PoolServer) joinIfNetworkPartitionForDynamicIPs() {
 		_, addrs = s.nodeMap.getNotJoinedAddresses(s.getJoinAddrs())
 		if len(addrs) == 0 {
 			atomic.StoreUint32(&s.ready, 1)
-			time.Sleep(s.options.joinRetryTime)
+			s.sleepJoinRetry(nil)
 			continue
 		}
 
@@ -235,22 +387,23 @@ func (s *PoolServer) joinIfNetworkPartitionForDynamicIPs() {
 		if err != nil {
 			s.options.logger.Error("Join error", zap.Error(err))
 		}
-		time.Sleep(s.options.joinRetryTime)
+		s.sleepJoinRetry(nil)
 	}
 }
 
+// getStaticIPAndPort accepts "host:port" and "[ipv6]:port"
 func getStaticIPAndPort(addr string) (string, uint16, error) {
-	list := strings.Split(addr, ":")
-	if len(list) < 2 {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
 		return "", 0, errors.New("invalid static address")
 	}
 
-	port, err := strconv.Atoi(list[1])
+	port, err := strconv.ParseUint(portStr, 10, 16)
 	if err != nil {
 		return "", 0, errors.New("invalid static address")
 	}
 
-	return list[0], uint16(port), nil
+	return host, uint16(port), nil
 }
 
 func validateServerConfig(conf ServerConfig) error {
@@ -258,16 +411,27 @@ func validateServerConfig(conf ServerConfig) error {
 		return errors.New("empty GRPCPort in ServerConfig")
 	}
 
+	err := validateAddressConfig(conf)
+	if err != nil {
+		return err
+	}
+
+	err = validateNodeName(conf.NodeName)
+	if err != nil {
+		return err
+	}
+
 	if conf.IsDynamicIPs {
 		if len(conf.ServiceAddr) == 0 {
 			return errors.New("empty ServiceAddr when IsDynamicIPs is true")
 		}
 	} else {
-		for _, addr := range conf.StaticAddrs {
-			_, _, err := getStaticIPAndPort(addr)
-			if err != nil {
-				return err
-			}
+		_, err = computeJoinAddrs(seedLists{
+			grpcAddrs:       conf.StaticAddrs,
+			memberlistAddrs: conf.StaticMemberlistAddrs,
+		}, 0)
+		if err != nil {
+			return err
 		}
 	}
 
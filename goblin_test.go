@@ -4,6 +4,8 @@ import (
 	"errors"
 	"github.com/stretchr/testify/assert"
 	"testing"
+	"time"
+	"unsafe"
 )
 
 func TestGetStaticIPAndPort(t *testing.T) {
@@ -28,6 +30,13 @@ func TestGetStaticIPAndPort(t *testing.T) {
 		assert.Equal(t, "address-1", ip)
 		assert.Equal(t, uint16(5000), port)
 	})
+
+	t.Run("ipv6", func(t *testing.T) {
+		ip, port, err := getStaticIPAndPort("[fd00::1]:5000")
+		assert.Equal(t, nil, err)
+		assert.Equal(t, "fd00::1", ip)
+		assert.Equal(t, uint16(5000), port)
+	})
 }
 
 func TestValidateServerConfig(t *testing.T) {
@@ -50,6 +59,35 @@ func TestValidateServerConfig(t *testing.T) {
 			},
 			err: errors.New("invalid static address"),
 		},
+		{
+			name: "invalid-static-memberlist-addr",
+			conf: ServerConfig{
+				GRPCPort: 4001,
+				StaticAddrs: []string{
+					"address-1:4001",
+				},
+				StaticMemberlistAddrs: []string{
+					"address-2",
+				},
+			},
+			err: errors.New("invalid static address"),
+		},
+		{
+			name: "invalid-advertise-addr",
+			conf: ServerConfig{
+				GRPCPort:      4001,
+				AdvertiseAddr: "some-host",
+			},
+			err: errors.New("invalid AdvertiseAddr"),
+		},
+		{
+			name: "invalid-node-name",
+			conf: ServerConfig{
+				GRPCPort: 4001,
+				NodeName: "node@1",
+			},
+			err: errors.New("NodeName must not contain '@' or ','"),
+		},
 		{
 			name: "service-addr-empty-when-dynamic",
 			conf: ServerConfig{
@@ -69,6 +107,19 @@ func TestValidateServerConfig(t *testing.T) {
 			},
 			err: nil,
 		},
+		{
+			name: "normal-static-ipv6",
+			conf: ServerConfig{
+				GRPCPort: 4001,
+				StaticAddrs: []string{
+					"[fd00::1]:4001",
+				},
+				StaticMemberlistAddrs: []string{
+					"[fd00::2]:7946",
+				},
+			},
+			err: nil,
+		},
 		{
 			name: "normal-dynamic",
 			conf: ServerConfig{
@@ -88,15 +139,36 @@ func TestValidateServerConfig(t *testing.T) {
 	}
 }
 
-func TestGetStaticJoinAddrs(t *testing.T) {
-	addrs := getStaticJoinAddrs(ServerConfig{
-		StaticAddrs: []string{
-			"address-1:8001",
-			"address-1:8002",
-		},
-	}, 2000)()
+func TestComputeStaticJoinAddrs(t *testing.T) {
+	addrs, err := computeStaticJoinAddrs([]string{
+		"address-1:8001",
+		"address-1:8002",
+	}, 2000)
+	assert.Equal(t, nil, err)
 	assert.Equal(t, []string{
 		"address-1:10001",
 		"address-1:10002",
 	}, addrs)
+
+	addrs, err = computeStaticJoinAddrs([]string{"[fd00::1]:8001"}, 2000)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{"[fd00::1]:10001"}, addrs)
+
+	addrs, err = computeStaticJoinAddrs([]string{"address-1"}, 2000)
+	assert.Equal(t, errors.New("invalid static address"), err)
+	assert.Equal(t, []string(nil), addrs)
+}
+
+func TestNewBroadcastQueue_Before_Memberlist_Created(t *testing.T) {
+	var members unsafe.Pointer
+	broadcasts := newBroadcastQueue(4, &members)
+
+	n := newNodeMap(30 * time.Second)
+	n.nodeJoin("name-1", "address-1")
+	d := newDelegate(n)
+	d.broadcasts = broadcasts
+
+	d.NotifyMsg(marshalBroadcast(broadcast{name: "name-1", addr: "address-1"}))
+	assert.Equal(t, 1, broadcasts.NumQueued())
+	assert.Equal(t, 1, len(d.GetBroadcasts(0, 1000)))
 }
@@ -22,6 +22,10 @@ type GoblinServiceClient interface {
 	Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (GoblinService_WatchClient, error)
 	// GetNode get node info
 	GetNode(ctx context.Context, in *GetNodeRequest, opts ...grpc.CallOption) (*GetNodeResponse, error)
+	// GetShardMap get the current assignment of shards to nodes
+	GetShardMap(ctx context.Context, in *GetShardMapRequest, opts ...grpc.CallOption) (*ShardMap, error)
+	// WatchShardMap watch for changes in the assignment of shards
+	WatchShardMap(ctx context.Context, in *WatchShardMapRequest, opts ...grpc.CallOption) (GoblinService_WatchShardMapClient, error)
 }
 
 type goblinServiceClient struct {
@@ -73,6 +77,47 @@ func (c *goblinServiceClient) GetNode(ctx context.Context, in *GetNodeRequest, o
 	return out, nil
 }
 
+func (c *goblinServiceClient) GetShardMap(ctx context.Context, in *GetShardMapRequest, opts ...grpc.CallOption) (*ShardMap, error) {
+	out := new(ShardMap)
+	err := c.cc.Invoke(ctx, "/goblin.GoblinService/GetShardMap", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *goblinServiceClient) WatchShardMap(ctx context.Context, in *WatchShardMapRequest, opts ...grpc.CallOption) (GoblinService_WatchShardMapClient, error) {
+	stream, err := c.cc.NewStream(ctx, &GoblinService_ServiceDesc.Streams[1], "/goblin.GoblinService/WatchShardMap", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &goblinServiceWatchShardMapClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type GoblinService_WatchShardMapClient interface {
+	Recv() (*ShardMap, error)
+	grpc.ClientStream
+}
+
+type goblinServiceWatchShardMapClient struct {
+	grpc.ClientStream
+}
+
+func (x *goblinServiceWatchShardMapClient) Recv() (*ShardMap, error) {
+	m := new(ShardMap)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // GoblinServiceServer is the server API for GoblinService service.
 // All implementations must embed UnimplementedGoblinServiceServer
 // for forward compatibility
@@ -81,6 +126,10 @@ type GoblinServiceServer interface {
 	Watch(*WatchRequest, GoblinService_WatchServer) error
 	// GetNode get node info
 	GetNode(context.Context, *GetNodeRequest) (*GetNodeResponse, error)
+	// GetShardMap get the current assignment of shards to nodes
+	GetShardMap(context.Context, *GetShardMapRequest) (*ShardMap, error)
+	// WatchShardMap watch for changes in the assignment of shards
+	WatchShardMap(*WatchShardMapRequest, GoblinService_WatchShardMapServer) error
 	mustEmbedUnimplementedGoblinServiceServer()
 }
 
@@ -94,6 +143,12 @@ func (UnimplementedGoblinServiceServer) Watch(*WatchRequest, GoblinService_Watch
 func (UnimplementedGoblinServiceServer) GetNode(context.Context, *GetNodeRequest) (*GetNodeResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetNode not implemented")
 }
+func (UnimplementedGoblinServiceServer) GetShardMap(context.Context, *GetShardMapRequest) (*ShardMap, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetShardMap not implemented")
+}
+func (UnimplementedGoblinServiceServer) WatchShardMap(*WatchShardMapRequest, GoblinService_WatchShardMapServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchShardMap not implemented")
+}
 func (UnimplementedGoblinServiceServer) mustEmbedUnimplementedGoblinServiceServer() {}
 
 // UnsafeGoblinServiceServer may be embedded to opt out of forward compatibility for this service.
@@ -146,6 +201,45 @@ func _GoblinService_GetNode_Handler(srv interface{}, ctx context.Context, dec fu
 	return interceptor(ctx, in, info, handler)
 }
 
+func _GoblinService_GetShardMap_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetShardMapRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GoblinServiceServer).GetShardMap(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/goblin.GoblinService/GetShardMap",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GoblinServiceServer).GetShardMap(ctx, req.(*GetShardMapRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GoblinService_WatchShardMap_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchShardMapRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(GoblinServiceServer).WatchShardMap(m, &goblinServiceWatchShardMapServer{stream})
+}
+
+type GoblinService_WatchShardMapServer interface {
+	Send(*ShardMap) error
+	grpc.ServerStream
+}
+
+type goblinServiceWatchShardMapServer struct {
+	grpc.ServerStream
+}
+
+func (x *goblinServiceWatchShardMapServer) Send(m *ShardMap) error {
+	return x.ServerStream.SendMsg(m)
+}
+
 // GoblinService_ServiceDesc is the grpc.ServiceDesc for GoblinService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -157,6 +251,10 @@ var GoblinService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "GetNode",
 			Handler:    _GoblinService_GetNode_Handler,
 		},
+		{
+			MethodName: "GetShardMap",
+			Handler:    _GoblinService_GetShardMap_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
@@ -164,6 +262,11 @@ var GoblinService_ServiceDesc = grpc.ServiceDesc{
 			Handler:       _GoblinService_Watch_Handler,
 			ServerStreams: true,
 		},
+		{
+			StreamName:    "WatchShardMap",
+			Handler:       _GoblinService_WatchShardMap_Handler,
+			ServerStreams: true,
+		},
 	},
 	Metadata: "goblin.proto",
 }
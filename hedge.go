@@ -0,0 +1,186 @@
+package goblin
+
+import (
+	"context"
+	"google.golang.org/grpc"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	latencySampleSize      = 1000
+	latencyMinSamples      = 20
+	latencyRecomputePeriod = 100 // recompute the percentile after this number of samples
+)
+
+// latencyTracker computes a percentile of the recent latencies
+type latencyTracker struct {
+	percentileValue float64
+
+	mu       sync.Mutex
+	samples  []time.Duration
+	next     int
+	recorded int
+	cached   time.Duration
+}
+
+func newLatencyTracker(percentile float64) *latencyTracker {
+	return &latencyTracker{
+		percentileValue: percentile,
+		samples:         make([]time.Duration, 0, latencySampleSize),
+	}
+}
+
+func (t *latencyTracker) record(d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.samples) < cap(t.samples) {
+		t.samples = append(t.samples, d)
+	} else {
+		t.samples[t.next] = d
+		t.next = (t.next + 1) % len(t.samples)
+	}
+
+	t.recorded++
+	if t.recorded%latencyRecomputePeriod == 0 || len(t.samples) == latencyMinSamples {
+		t.cached = computePercentile(t.samples, t.percentileValue)
+	}
+}
+
+// percentile returns zero if there are not enough samples
+func (t *latencyTracker) percentile() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.samples) < latencyMinSamples {
+		return 0
+	}
+	return t.cached
+}
+
+func computePercentile(samples []time.Duration, p float64) time.Duration {
+	if len(samples) == 0 {
+		return 0
+	}
+
+	sorted := append([]time.Duration(nil), samples...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+
+	index := int(p * float64(len(sorted)))
+	if index >= len(sorted) {
+		index = len(sorted) - 1
+	}
+	if index < 0 {
+		index = 0
+	}
+	return sorted[index]
+}
+
+// acquireHedgeConn returns a connection of a node other than excluded, nil if there is none
+func (c *PoolClient) acquireHedgeConn(excluded string) *clientConn {
+	tmp := c.getClientConns()
+	if tmp == nil {
+		return nil
+	}
+
+	for i := 0; i < len(tmp.conns); i++ {
+		conn, ok := c.getNextConn()
+		if !ok {
+			return nil
+		}
+		if conn.nodeName == excluded {
+			continue
+		}
+		if ok, _, _ := c.tryAcquireConn(conn); ok {
+			return conn
+		}
+	}
+	return nil
+}
+
+// GetConnHedged calls fn on a node, if it has not succeeded within hedgeDelay (or failed before that),
+// calls fn again on a second node. The first success wins and the other call is cancelled through ctx.
+// If hedgeDelay <= 0, the hedge percentile of recent latencies is used (see WithHedgePercentile),
+// no hedge is fired on slowness before enough latencies are recorded.
+//
+// fn must be idempotent and may run concurrently on two nodes, so it must synchronize writing
+// its results. GetConnHedged returns after all calls of fn returned, with the last error if all failed
+func (c *PoolClient) GetConnHedged(
+	ctx context.Context, fn func(ctx context.Context, conn *grpc.ClientConn) error, hedgeDelay time.Duration,
+) error {
+	first, err := c.acquireNextConn()
+	if err != nil {
+		return err
+	}
+
+	if hedgeDelay <= 0 {
+		hedgeDelay = c.hedgeLatency.percentile()
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan error, 2)
+
+	var timer <-chan time.Time
+	if hedgeDelay > 0 {
+		t := time.NewTimer(hedgeDelay)
+		defer t.Stop()
+		timer = t.C
+	}
+
+	c.startHedgedCall(ctx, first, fn, results)
+	running := 1
+	hedged := false
+
+	var lastErr error
+	for running > 0 {
+		select {
+		case err := <-results:
+			running--
+			if err == nil {
+				cancel()
+				waitResults(results, running)
+				return nil
+			}
+			lastErr = err
+		case <-timer:
+		}
+
+		timer = nil
+		if !hedged && ctx.Err() == nil {
+			hedged = true
+			if second := c.acquireHedgeConn(first.nodeName); second != nil {
+				c.startHedgedCall(ctx, second, fn, results)
+				running++
+			}
+		}
+	}
+	return lastErr
+}
+
+func (c *PoolClient) startHedgedCall(
+	ctx context.Context, conn *clientConn,
+	fn func(ctx context.Context, conn *grpc.ClientConn) error, results chan<- error,
+) {
+	go func() {
+		begin := time.Now()
+		err := c.doRequestConn(conn, func(cc *grpc.ClientConn) error {
+			return fn(ctx, cc)
+		}, false)
+		if err == nil {
+			c.hedgeLatency.record(time.Since(begin))
+		}
+		results <- err
+	}()
+}
+
+func waitResults(results <-chan error, n int) {
+	for i := 0; i < n; i++ {
+		<-results
+	}
+}
@@ -0,0 +1,158 @@
+package goblin
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"sync"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+func newTestHedgePoolClient(t *testing.T, names ...string) *PoolClient {
+	pool := makePoolClient(ClientConfig{})
+	conns := &clientConns{}
+	for _, name := range names {
+		cc, err := grpc.Dial("127.0.0.1:5600", grpc.WithInsecure())
+		assert.Equal(t, nil, err)
+		conns.conns = append(conns.conns, &clientConn{
+			conn:     unsafe.Pointer(cc),
+			nodeName: name,
+			refCount: 1,
+			state:    newConnState(),
+		})
+	}
+	pool.setClientConns(conns)
+	t.Cleanup(func() {
+		_ = pool.Close()
+	})
+	return pool
+}
+
+// hedgeCallRecorder counts the calls of fn
+type hedgeCallRecorder struct {
+	mu    sync.Mutex
+	calls int
+}
+
+func (r *hedgeCallRecorder) call() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls++
+	return r.calls
+}
+
+func TestComputePercentile(t *testing.T) {
+	assert.Equal(t, time.Duration(0), computePercentile(nil, 0.95))
+
+	var samples []time.Duration
+	for i := 100; i >= 1; i-- {
+		samples = append(samples, time.Duration(i)*time.Millisecond)
+	}
+	assert.Equal(t, 96*time.Millisecond, computePercentile(samples, 0.95))
+	assert.Equal(t, 100*time.Millisecond, computePercentile(samples, 1))
+	assert.Equal(t, 1*time.Millisecond, computePercentile(samples, 0))
+}
+
+func TestLatencyTracker(t *testing.T) {
+	tracker := newLatencyTracker(0.5)
+	for i := 1; i < latencyMinSamples; i++ {
+		tracker.record(time.Duration(i) * time.Millisecond)
+	}
+	assert.Equal(t, time.Duration(0), tracker.percentile())
+
+	tracker.record(latencyMinSamples * time.Millisecond)
+	assert.Equal(t, 11*time.Millisecond, tracker.percentile())
+
+	for i := 0; i < latencySampleSize+latencyRecomputePeriod; i++ {
+		tracker.record(time.Second)
+	}
+	assert.Equal(t, latencySampleSize, len(tracker.samples))
+	assert.Equal(t, time.Second, tracker.percentile())
+}
+
+func TestPoolClient_GetConnHedged_Fast(t *testing.T) {
+	pool := newTestHedgePoolClient(t, "name-1", "name-2")
+	r := &hedgeCallRecorder{}
+
+	err := pool.GetConnHedged(context.Background(), func(ctx context.Context, conn *grpc.ClientConn) error {
+		r.call()
+		return nil
+	}, 50*time.Millisecond)
+	assert.Equal(t, nil, err)
+
+	time.Sleep(80 * time.Millisecond)
+	assert.Equal(t, 1, r.calls)
+}
+
+func TestPoolClient_GetConnHedged_Slow_Primary(t *testing.T) {
+	pool := newTestHedgePoolClient(t, "name-1", "name-2")
+	r := &hedgeCallRecorder{}
+
+	cancelled := false
+	err := pool.GetConnHedged(context.Background(), func(ctx context.Context, conn *grpc.ClientConn) error {
+		if r.call() == 1 {
+			<-ctx.Done()
+			cancelled = true
+			return ctx.Err()
+		}
+		return nil
+	}, 10*time.Millisecond)
+
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, r.calls)
+	assert.Equal(t, true, cancelled)
+	for _, conn := range pool.getClientConns().conns {
+		assert.Equal(t, uint64(1), conn.refCount)
+	}
+}
+
+func TestPoolClient_GetConnHedged_Primary_Failed(t *testing.T) {
+	pool := newTestHedgePoolClient(t, "name-1", "name-2")
+	r := &hedgeCallRecorder{}
+
+	begin := time.Now()
+	err := pool.GetConnHedged(context.Background(), func(ctx context.Context, conn *grpc.ClientConn) error {
+		if r.call() == 1 {
+			return errors.New("primary error")
+		}
+		return nil
+	}, time.Minute)
+
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, r.calls)
+	assert.Less(t, int64(time.Since(begin)), int64(time.Second))
+}
+
+func TestPoolClient_GetConnHedged_All_Failed(t *testing.T) {
+	pool := newTestHedgePoolClient(t, "name-1", "name-2")
+
+	callErr := errors.New("call error")
+	err := pool.GetConnHedged(context.Background(), func(ctx context.Context, conn *grpc.ClientConn) error {
+		return callErr
+	}, time.Minute)
+	assert.Equal(t, callErr, err)
+}
+
+func TestPoolClient_GetConnHedged_Single_Node(t *testing.T) {
+	pool := newTestHedgePoolClient(t, "name-1", "name-1")
+	r := &hedgeCallRecorder{}
+
+	err := pool.GetConnHedged(context.Background(), func(ctx context.Context, conn *grpc.ClientConn) error {
+		r.call()
+		time.Sleep(30 * time.Millisecond)
+		return nil
+	}, time.Millisecond)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, r.calls)
+}
+
+func TestPoolClient_GetConnHedged_No_Conn(t *testing.T) {
+	pool := makePoolClient(ClientConfig{})
+	err := pool.GetConnHedged(context.Background(), func(ctx context.Context, conn *grpc.ClientConn) error {
+		return nil
+	}, time.Millisecond)
+	assert.Equal(t, ErrNoConn, err)
+}
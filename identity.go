@@ -0,0 +1,82 @@
+package goblin
+
+import (
+	"errors"
+	"github.com/google/uuid"
+	"github.com/hashicorp/memberlist"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// deadNodeReclaimTime allows a node with a stable name to restart with a new address
+// after its previous instance is detected as dead
+const deadNodeReclaimTime = 10 * time.Second
+
+// nodeNameFile is the file in ServerConfig.DataDir storing the generated node name
+const nodeNameFile = "node-name"
+
+// validateNodeName names are used in the legacy "name@addr,name@addr" formats
+func validateNodeName(name string) error {
+	if strings.ContainsAny(name, "@,") {
+		return errors.New("NodeName must not contain '@' or ','")
+	}
+	for _, c := range name {
+		if c < 0x20 {
+			return errors.New("NodeName must not contain control characters")
+		}
+	}
+	return nil
+}
+
+// loadOrCreateNodeName returns the configured name, or the name persisted in the data dir
+// (generated on first start), or a new name if neither is configured
+func loadOrCreateNodeName(config ServerConfig) (string, error) {
+	if config.NodeName != "" {
+		return config.NodeName, nil
+	}
+	if config.DataDir == "" {
+		return uuid.New().String(), nil
+	}
+
+	path := filepath.Join(config.DataDir, nodeNameFile)
+	data, err := ioutil.ReadFile(path)
+	if err == nil {
+		name := strings.TrimSpace(string(data))
+		if name == "" {
+			return "", errors.New("empty node name in " + path)
+		}
+		return name, validateNodeName(name)
+	}
+	if !os.IsNotExist(err) {
+		return "", err
+	}
+
+	err = os.MkdirAll(config.DataDir, 0755)
+	if err != nil {
+		return "", err
+	}
+
+	name := uuid.New().String()
+	err = writeFileAtomic(path, []byte(name+"\n"))
+	if err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// configureNodeIdentity sets the name of the node, a stable name can be reclaimed by a restarted node
+func configureNodeIdentity(config ServerConfig, mconf *memberlist.Config) error {
+	name, err := loadOrCreateNodeName(config)
+	if err != nil {
+		return err
+	}
+
+	mconf.Name = name
+	if config.NodeName != "" || config.DataDir != "" {
+		mconf.DeadNodeReclaimTime = deadNodeReclaimTime
+	}
+	return nil
+}
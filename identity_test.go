@@ -0,0 +1,66 @@
+package goblin
+
+import (
+	"errors"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidateNodeName(t *testing.T) {
+	assert.Equal(t, nil, validateNodeName(""))
+	assert.Equal(t, nil, validateNodeName("node-1.zone-a"))
+	assert.Equal(t, errors.New("NodeName must not contain '@' or ','"), validateNodeName("node@1"))
+	assert.Equal(t, errors.New("NodeName must not contain '@' or ','"), validateNodeName("node,1"))
+	assert.Equal(t, errors.New("NodeName must not contain control characters"), validateNodeName("\x01node"))
+}
+
+func TestLoadOrCreateNodeName(t *testing.T) {
+	t.Run("configured", func(t *testing.T) {
+		name, err := loadOrCreateNodeName(ServerConfig{NodeName: "node-1", DataDir: t.TempDir()})
+		assert.Equal(t, nil, err)
+		assert.Equal(t, "node-1", name)
+	})
+
+	t.Run("generated", func(t *testing.T) {
+		name1, err := loadOrCreateNodeName(ServerConfig{})
+		assert.Equal(t, nil, err)
+		name2, err := loadOrCreateNodeName(ServerConfig{})
+		assert.Equal(t, nil, err)
+
+		_, err = uuid.Parse(name1)
+		assert.Equal(t, nil, err)
+		assert.NotEqual(t, name1, name2)
+	})
+
+	t.Run("persisted", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "data")
+
+		name1, err := loadOrCreateNodeName(ServerConfig{DataDir: dir})
+		assert.Equal(t, nil, err)
+		name2, err := loadOrCreateNodeName(ServerConfig{DataDir: dir})
+		assert.Equal(t, nil, err)
+		assert.Equal(t, name1, name2)
+
+		data, err := ioutil.ReadFile(filepath.Join(dir, nodeNameFile))
+		assert.Equal(t, nil, err)
+		assert.Equal(t, name1+"\n", string(data))
+	})
+
+	t.Run("invalid-persisted", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, nodeNameFile)
+
+		err := ioutil.WriteFile(path, []byte(" \n"), 0644)
+		assert.Equal(t, nil, err)
+		_, err = loadOrCreateNodeName(ServerConfig{DataDir: dir})
+		assert.Equal(t, errors.New("empty node name in "+path), err)
+
+		err = ioutil.WriteFile(path, []byte("node@1"), 0644)
+		assert.Equal(t, nil, err)
+		_, err = loadOrCreateNodeName(ServerConfig{DataDir: dir})
+		assert.Equal(t, errors.New("NodeName must not contain '@' or ','"), err)
+	})
+}
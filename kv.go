@@ -0,0 +1,283 @@
+package goblin
+
+import (
+	"github.com/QuangTung97/goblin/goblinpb"
+	"github.com/hashicorp/memberlist"
+	"sync"
+	"time"
+)
+
+// KVStore is a small eventually consistent key/value map replicated to all members,
+// concurrent updates of a key are resolved by last-writer-wins using lamport clocks
+// (ties are broken by node names). Updates are gossiped and merged during memberlist push/pull,
+// so it is only suitable for small bits of cluster config
+type KVStore struct {
+	name         string
+	maxSize      int
+	tombstoneTTL time.Duration
+
+	broadcasts *memberlist.TransmitLimitedQueue
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	clock   uint64
+	entries map[string]kvEntry
+	values  map[string][]byte // immutable snapshot of live values
+	seq     uint64
+	getNow  func() time.Time
+}
+
+type kvEntry struct {
+	value   []byte
+	clock   uint64
+	node    string
+	deleted bool
+
+	deletedAt time.Time // local time receiving the tombstone, for garbage collection
+}
+
+func newKVStore(name string, maxSize int, tombstoneTTL time.Duration) *KVStore {
+	kv := &KVStore{
+		name:         name,
+		maxSize:      maxSize,
+		tombstoneTTL: tombstoneTTL,
+
+		entries: map[string]kvEntry{},
+		values:  map[string][]byte{},
+		getNow:  func() time.Time { return time.Now() },
+	}
+	kv.cond = sync.NewCond(&kv.mu)
+	return kv
+}
+
+// newer compares (clock, node) lexicographically
+func (e kvEntry) newer(other kvEntry) bool {
+	if e.clock != other.clock {
+		return e.clock > other.clock
+	}
+	return e.node > other.node
+}
+
+func kvEntryFromProto(e *goblinpb.KVEntry) kvEntry {
+	return kvEntry{
+		value:   e.Value,
+		clock:   e.Clock,
+		node:    e.Node,
+		deleted: e.Deleted,
+	}
+}
+
+func (e kvEntry) toProto(key string) *goblinpb.KVEntry {
+	return &goblinpb.KVEntry{
+		Key:     key,
+		Value:   e.value,
+		Clock:   e.clock,
+		Node:    e.node,
+		Deleted: e.deleted,
+	}
+}
+
+// Get returns a copy of the value of a key
+func (kv *KVStore) Get(key string) ([]byte, bool) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+
+	value, existed := kv.values[key]
+	if !existed {
+		return nil, false
+	}
+	return append([]byte{}, value...), true
+}
+
+// GetAll returns the sequence number and all values, the map and its values must not be modified
+func (kv *KVStore) GetAll() (uint64, map[string][]byte) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	return kv.seq, kv.values
+}
+
+// Watch blocks until the sequence number is greater than lastSeq, returns the same as GetAll.
+// Also returns after PoolServer.Shutdown
+func (kv *KVStore) Watch(lastSeq uint64) (uint64, map[string][]byte) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+
+	for kv.seq <= lastSeq {
+		kv.cond.Wait()
+	}
+	return kv.seq, kv.values
+}
+
+// Set sets the value of a key, returns ErrMessageTooLarge if the entry does not fit in a gossip packet
+func (kv *KVStore) Set(key string, value []byte) error {
+	return kv.update(key, append([]byte(nil), value...), false)
+}
+
+// Delete deletes a key, the tombstone is kept for the tombstone TTL
+func (kv *KVStore) Delete(key string) error {
+	return kv.update(key, nil, true)
+}
+
+func (kv *KVStore) update(key string, value []byte, deleted bool) error {
+	kv.mu.Lock()
+
+	entry := kvEntry{
+		value:   value,
+		clock:   kv.clock + 1,
+		node:    kv.name,
+		deleted: deleted,
+	}
+	msg, err := marshalPrefixed(kvMessagePrefix, entry.toProto(key))
+	if err != nil {
+		kv.mu.Unlock()
+		return err
+	}
+	if len(msg) > kv.maxSize {
+		kv.mu.Unlock()
+		return ErrMessageTooLarge
+	}
+
+	kv.clock = entry.clock
+	kv.applyLocked(key, entry)
+	// queue inside the lock so that an older update never invalidates a newer one
+	kv.broadcasts.QueueBroadcast(kvBroadcast{key: key, msg: msg})
+	kv.mu.Unlock()
+
+	kv.cond.Broadcast()
+	return nil
+}
+
+// applyLocked does not compare entries, the caller must make sure the entry is newer
+func (kv *KVStore) applyLocked(key string, entry kvEntry) {
+	if entry.deleted {
+		entry.value = nil
+		entry.deletedAt = kv.getNow()
+	}
+	kv.entries[key] = entry
+
+	values := make(map[string][]byte, len(kv.values)+1)
+	for k, v := range kv.values {
+		values[k] = v
+	}
+	if entry.deleted {
+		delete(values, key)
+	} else {
+		values[key] = entry.value
+	}
+	kv.values = values
+	kv.seq++
+}
+
+// mergeLocked returns true if the entry is newer than the local one
+func (kv *KVStore) mergeLocked(e *goblinpb.KVEntry) bool {
+	entry := kvEntryFromProto(e)
+	if entry.clock > kv.clock {
+		kv.clock = entry.clock
+	}
+
+	old, existed := kv.entries[e.Key]
+	if existed && !entry.newer(old) {
+		return false
+	}
+
+	// tombstones of unknown keys are not stored, so that expired tombstones are not revived by push/pull
+	if !existed && entry.deleted {
+		return false
+	}
+
+	kv.applyLocked(e.Key, entry)
+	return true
+}
+
+// receive re-broadcasts the update only if it is newer, for reaching all nodes
+func (kv *KVStore) receive(msg []byte) {
+	e := &goblinpb.KVEntry{}
+	if !unmarshalPrefixed(kvMessagePrefix, msg, e) {
+		return
+	}
+
+	kv.mu.Lock()
+	changed := kv.mergeLocked(e)
+	if changed {
+		kv.broadcasts.QueueBroadcast(kvBroadcast{key: e.Key, msg: append([]byte(nil), msg...)})
+	}
+	kv.mu.Unlock()
+
+	if changed {
+		kv.cond.Broadcast()
+	}
+}
+
+func (kv *KVStore) mergeEntries(entries []*goblinpb.KVEntry) {
+	changed := false
+
+	kv.mu.Lock()
+	for _, e := range entries {
+		if kv.mergeLocked(e) {
+			changed = true
+		}
+	}
+	kv.mu.Unlock()
+
+	if changed {
+		kv.cond.Broadcast()
+	}
+}
+
+// getEntries also removes expired tombstones
+func (kv *KVStore) getEntries() []*goblinpb.KVEntry {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+
+	now := kv.getNow()
+	result := make([]*goblinpb.KVEntry, 0, len(kv.entries))
+	for key, entry := range kv.entries {
+		if entry.deleted && !entry.deletedAt.Add(kv.tombstoneTTL).After(now) {
+			delete(kv.entries, key)
+			continue
+		}
+		result = append(result, entry.toProto(key))
+	}
+	return result
+}
+
+func (kv *KVStore) close() {
+	kv.mu.Lock()
+	kv.seq++
+	kv.mu.Unlock()
+
+	kv.cond.Broadcast()
+}
+
+// KV returns the replicated key/value store
+func (s *PoolServer) KV() *KVStore {
+	return s.kv
+}
+
+// kvBroadcast a newer update of a key invalidates the older one in the queue
+type kvBroadcast struct {
+	key string
+	msg []byte
+}
+
+var _ memberlist.NamedBroadcast = kvBroadcast{}
+
+func (b kvBroadcast) Invalidates(other memberlist.Broadcast) bool {
+	nb, ok := other.(memberlist.NamedBroadcast)
+	if !ok {
+		return false
+	}
+	return b.Name() == nb.Name()
+}
+
+func (b kvBroadcast) Message() []byte {
+	return b.msg
+}
+
+func (b kvBroadcast) Finished() {
+}
+
+// Name is prefixed for not conflicting with node names of leave broadcasts
+func (b kvBroadcast) Name() string {
+	return "kv/" + b.key
+}
@@ -0,0 +1,167 @@
+package goblin
+
+import (
+	"bytes"
+	"github.com/QuangTung97/goblin/goblinpb"
+	"github.com/hashicorp/memberlist"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestKVStore(name string) *KVStore {
+	kv := newKVStore(name, 1000, time.Minute)
+	kv.broadcasts = &memberlist.TransmitLimitedQueue{
+		RetransmitMult: 4,
+		NumNodes:       func() int { return 3 },
+	}
+	return kv
+}
+
+func kvQueuedValue(t *testing.T, kv *KVStore) []byte {
+	msgs := kv.broadcasts.GetBroadcasts(0, 10000)
+	assert.Equal(t, 1, len(msgs))
+
+	e := &goblinpb.KVEntry{}
+	assert.Equal(t, true, unmarshalPrefixed(kvMessagePrefix, msgs[0], e))
+	return e.Value
+}
+
+func TestKVStore_Set_Get_Delete(t *testing.T) {
+	kv := newTestKVStore("node-1")
+
+	value := []byte("value-1")
+	err := kv.Set("key-1", value)
+	assert.Equal(t, nil, err)
+	value[0] = 'x'
+
+	result, ok := kv.Get("key-1")
+	assert.Equal(t, true, ok)
+	assert.Equal(t, "value-1", string(result))
+
+	// the result is a copy
+	result[0] = 'x'
+	result, _ = kv.Get("key-1")
+	assert.Equal(t, "value-1", string(result))
+	assert.Equal(t, "value-1", string(kvQueuedValue(t, kv)))
+
+	err = kv.Delete("key-1")
+	assert.Equal(t, nil, err)
+
+	_, ok = kv.Get("key-1")
+	assert.Equal(t, false, ok)
+
+	seq, values := kv.GetAll()
+	assert.Equal(t, uint64(2), seq)
+	assert.Equal(t, map[string][]byte{}, values)
+	assert.Equal(t, uint64(2), kv.clock)
+
+	// the delete invalidates the queued set
+	assert.Equal(t, 1, kv.broadcasts.NumQueued())
+}
+
+func TestKVStore_Set_Too_Large(t *testing.T) {
+	kv := newTestKVStore("node-1")
+	err := kv.Set("key-1", bytes.Repeat([]byte("a"), 1000))
+	assert.Equal(t, ErrMessageTooLarge, err)
+
+	_, ok := kv.Get("key-1")
+	assert.Equal(t, false, ok)
+	assert.Equal(t, uint64(0), kv.clock)
+}
+
+func TestKVStore_Receive_Last_Writer_Wins(t *testing.T) {
+	kv1 := newTestKVStore("node-1")
+	kv2 := newTestKVStore("node-2")
+
+	// concurrent updates with the same clock
+	assert.Equal(t, nil, kv1.Set("key-1", []byte("value-1")))
+	assert.Equal(t, nil, kv2.Set("key-1", []byte("value-2")))
+
+	for _, msg := range kv1.broadcasts.GetBroadcasts(0, 10000) {
+		kv2.receive(msg)
+	}
+	for _, msg := range kv2.broadcasts.GetBroadcasts(0, 10000) {
+		kv1.receive(msg)
+	}
+
+	result1, _ := kv1.Get("key-1")
+	result2, _ := kv2.Get("key-1")
+	assert.Equal(t, "value-2", string(result1))
+	assert.Equal(t, "value-2", string(result2))
+
+	// only the newer update is re-broadcast, it invalidates the older one
+	assert.Equal(t, 1, kv1.broadcasts.NumQueued())
+	assert.Equal(t, "value-2", string(kvQueuedValue(t, kv1)))
+	assert.Equal(t, 1, kv2.broadcasts.NumQueued())
+
+	// the clock is advanced after receiving
+	assert.Equal(t, nil, kv1.Set("key-1", []byte("value-3")))
+	assert.Equal(t, uint64(2), kv1.clock)
+}
+
+func TestKVStore_Merge_Local_State(t *testing.T) {
+	d1 := newDelegate(newNodeMap(30 * time.Second))
+	d1.kv = newTestKVStore("node-1")
+	d2 := newDelegate(newNodeMap(30 * time.Second))
+	d2.kv = newTestKVStore("node-2")
+	d2.broadcasts = d2.kv.broadcasts
+
+	assert.Equal(t, nil, d1.kv.Set("key-1", []byte("value-1")))
+	assert.Equal(t, nil, d1.kv.Set("key-2", []byte("value-2")))
+	assert.Equal(t, nil, d1.kv.Delete("key-2"))
+	assert.Equal(t, nil, d2.kv.Set("key-2", []byte("old")))
+
+	d2.MergeRemoteState(d1.LocalState(false), false)
+
+	seq, values := d2.kv.GetAll()
+	assert.Equal(t, uint64(3), seq)
+	assert.Equal(t, map[string][]byte{"key-1": []byte("value-1")}, values)
+}
+
+func TestKVStore_Tombstone_Expired(t *testing.T) {
+	kv := newTestKVStore("node-1")
+	now := mustParse("2021-06-18T09:00:00+07:00")
+	kv.getNow = func() time.Time { return now }
+
+	assert.Equal(t, nil, kv.Set("key-1", []byte("value-1")))
+	assert.Equal(t, nil, kv.Delete("key-1"))
+	assert.Equal(t, 1, len(kv.getEntries()))
+
+	kv.getNow = func() time.Time { return now.Add(time.Minute) }
+	assert.Equal(t, []*goblinpb.KVEntry{}, kv.getEntries())
+
+	// expired tombstones from other nodes are not stored again
+	kv.mergeEntries([]*goblinpb.KVEntry{{Key: "key-1", Clock: 2, Node: "node-2", Deleted: true}})
+	assert.Equal(t, []*goblinpb.KVEntry{}, kv.getEntries())
+}
+
+func TestKVStore_Watch(t *testing.T) {
+	kv := newTestKVStore("node-1")
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	var seq uint64
+	var values map[string][]byte
+	go func() {
+		defer wg.Done()
+		seq, values = kv.Watch(0)
+	}()
+
+	assert.Equal(t, nil, kv.Set("key-1", []byte("value-1")))
+	wg.Wait()
+
+	assert.Equal(t, uint64(1), seq)
+	assert.Equal(t, map[string][]byte{"key-1": []byte("value-1")}, values)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		seq, _ = kv.Watch(seq)
+	}()
+	kv.close()
+	wg.Wait()
+	assert.Equal(t, uint64(2), seq)
+}
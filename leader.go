@@ -0,0 +1,217 @@
+package goblin
+
+import (
+	"sync"
+	"time"
+)
+
+// leaderElector chooses the lowest name among stable members as the leader,
+// a member is stable after it has been seen continuously for the stability delay
+type leaderElector struct {
+	delay    time.Duration
+	expected int // expected number of members, zero for using the maximum number seen
+	getNow   func() time.Time
+
+	mu        sync.Mutex
+	cond      *sync.Cond
+	leader    string
+	seq       uint64
+	suspected bool
+
+	// only accessed by the election goroutine
+	firstSeen  map[string]time.Time
+	maxMembers int
+}
+
+func newLeaderElector(delay time.Duration, expected int) *leaderElector {
+	e := &leaderElector{
+		delay:    delay,
+		expected: expected,
+		getNow:   func() time.Time { return time.Now() },
+
+		firstSeen: map[string]time.Time{},
+	}
+	e.cond = sync.NewCond(&e.mu)
+	return e
+}
+
+// computeLeader returns the lowest stable name and the duration until another member becomes stable (zero if none)
+func computeLeader(firstSeen map[string]time.Time, now time.Time, delay time.Duration) (string, time.Duration) {
+	leader := ""
+	var next time.Duration
+	for name, seen := range firstSeen {
+		remaining := seen.Add(delay).Sub(now)
+		if remaining > 0 {
+			if next == 0 || remaining < next {
+				next = remaining
+			}
+			continue
+		}
+
+		if leader == "" || name < leader {
+			leader = name
+		}
+	}
+	return leader, next
+}
+
+// updateMembers nodes that left gracefully are not counted for suspecting partitions
+func (e *leaderElector) updateMembers(nodes map[string]Node, leftNodes map[string]leftNode) {
+	now := e.getNow()
+	for name := range nodes {
+		if _, existed := e.firstSeen[name]; !existed {
+			e.firstSeen[name] = now
+		}
+	}
+
+	for name := range e.firstSeen {
+		if _, existed := nodes[name]; existed {
+			continue
+		}
+		delete(e.firstSeen, name)
+		if _, left := leftNodes[name]; left && e.maxMembers > 0 {
+			e.maxMembers--
+		}
+	}
+
+	if len(nodes) > e.maxMembers {
+		e.maxMembers = len(nodes)
+	}
+}
+
+// evaluate returns the duration until it should be evaluated again (zero if not needed)
+func (e *leaderElector) evaluate() time.Duration {
+	leader, next := computeLeader(e.firstSeen, e.getNow(), e.delay)
+
+	expected := e.expected
+	if expected <= 0 {
+		expected = e.maxMembers
+	}
+	suspected := 2*len(e.firstSeen) <= expected
+
+	e.mu.Lock()
+	changed := leader != e.leader
+	if changed {
+		e.leader = leader
+		e.seq++
+	}
+	e.suspected = suspected
+	e.mu.Unlock()
+
+	if changed {
+		e.cond.Broadcast()
+	}
+	return next
+}
+
+func (e *leaderElector) getLeader() (uint64, string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.seq, e.leader
+}
+
+func (e *leaderElector) watchLeader(lastSeq uint64) (uint64, string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for e.seq <= lastSeq {
+		e.cond.Wait()
+	}
+	return e.seq, e.leader
+}
+
+func (e *leaderElector) partitionSuspected() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.suspected
+}
+
+func (e *leaderElector) close() {
+	e.mu.Lock()
+	e.seq++
+	e.mu.Unlock()
+
+	e.cond.Broadcast()
+}
+
+func (s *PoolServer) runLeaderElection() {
+	changes := make(chan map[string]Node, 1)
+	go s.pumpNodeChanges(changes)
+
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+	defer timer.Stop()
+
+	_, nodes := s.nodeMap.getNodes()
+	for {
+		s.leader.updateMembers(nodes, s.nodeMap.getLeftNodes())
+		next := s.leader.evaluate()
+
+		var timeout <-chan time.Time
+		if next > 0 {
+			timer.Reset(next)
+			timeout = timer.C
+		}
+
+		select {
+		case nodes = <-changes:
+		case <-timeout:
+			continue
+		case <-s.ctx.Done():
+			s.leader.close()
+			return
+		}
+
+		// drain the timer if it fired before being stopped
+		if next > 0 && !timer.Stop() {
+			<-timer.C
+		}
+	}
+}
+
+// pumpNodeChanges sends only the latest snapshot if the receiver is slow
+func (s *PoolServer) pumpNodeChanges(changes chan map[string]Node) {
+	seq, _ := s.nodeMap.getNodes()
+	for {
+		var nodes map[string]Node
+		seq, nodes = s.nodeMap.watchNodes(seq)
+		if s.ctx.Err() != nil {
+			return
+		}
+
+		select {
+		case <-changes:
+		default:
+		}
+		changes <- nodes
+	}
+}
+
+// Leader returns the name of the coordinator, the lowest name among members that have been
+// stable for the leader stability delay, empty if there is no stable member.
+//
+// It is computed from the local membership view, so there can be multiple leaders
+// (split-brain) during network partitions or membership changes. Jobs requiring
+// exactly one runner must be idempotent or use a real consensus system,
+// PartitionSuspected can be used for pausing jobs in minority partitions
+func (s *PoolServer) Leader() string {
+	_, leader := s.leader.getLeader()
+	return leader
+}
+
+// IsLeader returns whether the current node is the leader, see Leader for the split-brain caveat
+func (s *PoolServer) IsLeader() bool {
+	return s.Leader() == s.name
+}
+
+// WatchLeader blocks until the leader changes from the one of lastSeq, starts with lastSeq = 0.
+// Also returns after Shutdown
+func (s *PoolServer) WatchLeader(lastSeq uint64) (uint64, string) {
+	return s.leader.watchLeader(lastSeq)
+}
+
+// PartitionSuspected returns true when the number of members is not a majority of the expected
+// members (configured by WithExpectedMembers, or the maximum number seen excluding nodes that left gracefully)
+func (s *PoolServer) PartitionSuspected() bool {
+	return s.leader.partitionSuspected()
+}
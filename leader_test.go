@@ -0,0 +1,135 @@
+package goblin
+
+import (
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestComputeLeader(t *testing.T) {
+	now := mustParse("2021-06-18T09:00:00+07:00")
+
+	leader, next := computeLeader(map[string]time.Time{}, now, 10*time.Second)
+	assert.Equal(t, "", leader)
+	assert.Equal(t, time.Duration(0), next)
+
+	leader, next = computeLeader(map[string]time.Time{
+		"name-1": now.Add(-3 * time.Second),
+		"name-2": now.Add(-20 * time.Second),
+		"name-3": now.Add(-10 * time.Second),
+		"name-4": now.Add(-5 * time.Second),
+	}, now, 10*time.Second)
+	assert.Equal(t, "name-2", leader)
+	assert.Equal(t, 5*time.Second, next)
+}
+
+func TestLeaderElector(t *testing.T) {
+	e := newLeaderElector(10*time.Second, 0)
+	now := mustParse("2021-06-18T09:00:00+07:00")
+	e.getNow = func() time.Time { return now }
+
+	e.updateMembers(map[string]Node{"name-2": {}, "name-3": {}}, nil)
+	assert.Equal(t, 10*time.Second, e.evaluate())
+
+	seq, leader := e.getLeader()
+	assert.Equal(t, uint64(0), seq)
+	assert.Equal(t, "", leader)
+
+	now = now.Add(5 * time.Second)
+	e.updateMembers(map[string]Node{"name-1": {}, "name-2": {}, "name-3": {}}, nil)
+	assert.Equal(t, 5*time.Second, e.evaluate())
+
+	now = now.Add(5 * time.Second)
+	assert.Equal(t, 5*time.Second, e.evaluate())
+	seq, leader = e.getLeader()
+	assert.Equal(t, uint64(1), seq)
+	assert.Equal(t, "name-2", leader)
+
+	now = now.Add(5 * time.Second)
+	assert.Equal(t, time.Duration(0), e.evaluate())
+	seq, leader = e.getLeader()
+	assert.Equal(t, uint64(2), seq)
+	assert.Equal(t, "name-1", leader)
+
+	// the same leader does not increase seq
+	e.evaluate()
+	seq, _ = e.getLeader()
+	assert.Equal(t, uint64(2), seq)
+
+	// rejoined members must be stable again
+	e.updateMembers(map[string]Node{"name-2": {}, "name-3": {}}, nil)
+	e.evaluate()
+	e.updateMembers(map[string]Node{"name-1": {}, "name-2": {}, "name-3": {}}, nil)
+	e.evaluate()
+	_, leader = e.getLeader()
+	assert.Equal(t, "name-2", leader)
+}
+
+func TestLeaderElector_Partition_Suspected(t *testing.T) {
+	e := newLeaderElector(0, 0)
+	nodes := map[string]Node{"name-1": {}, "name-2": {}, "name-3": {}, "name-4": {}}
+
+	e.updateMembers(nodes, nil)
+	e.evaluate()
+	assert.Equal(t, false, e.partitionSuspected())
+
+	delete(nodes, "name-4")
+	e.updateMembers(nodes, nil)
+	e.evaluate()
+	assert.Equal(t, false, e.partitionSuspected())
+
+	delete(nodes, "name-3")
+	e.updateMembers(nodes, nil)
+	e.evaluate()
+	assert.Equal(t, true, e.partitionSuspected())
+
+	// nodes left gracefully are not expected anymore
+	e = newLeaderElector(0, 0)
+	e.updateMembers(map[string]Node{"name-1": {}, "name-2": {}, "name-3": {}, "name-4": {}}, nil)
+	e.updateMembers(map[string]Node{"name-1": {}, "name-2": {}}, map[string]leftNode{"name-3": {}, "name-4": {}})
+	e.evaluate()
+	assert.Equal(t, false, e.partitionSuspected())
+	assert.Equal(t, 2, e.maxMembers)
+}
+
+func TestLeaderElector_Expected_Members(t *testing.T) {
+	e := newLeaderElector(0, 5)
+	e.updateMembers(map[string]Node{"name-1": {}, "name-2": {}}, nil)
+	e.evaluate()
+	assert.Equal(t, true, e.partitionSuspected())
+
+	e.updateMembers(map[string]Node{"name-1": {}, "name-2": {}, "name-3": {}}, nil)
+	e.evaluate()
+	assert.Equal(t, false, e.partitionSuspected())
+}
+
+func TestLeaderElector_Watch(t *testing.T) {
+	e := newLeaderElector(0, 0)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	var seq uint64
+	var leader string
+	go func() {
+		defer wg.Done()
+		seq, leader = e.watchLeader(0)
+	}()
+
+	e.updateMembers(map[string]Node{"name-1": {}}, nil)
+	e.evaluate()
+	wg.Wait()
+
+	assert.Equal(t, uint64(1), seq)
+	assert.Equal(t, "name-1", leader)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		seq, _ = e.watchLeader(seq)
+	}()
+	e.close()
+	wg.Wait()
+	assert.Equal(t, uint64(2), seq)
+}
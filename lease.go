@@ -0,0 +1,90 @@
+package goblin
+
+import (
+	"context"
+	"google.golang.org/grpc"
+	"sync/atomic"
+)
+
+// Lease is a connection leased from PoolClient, unlike GetConn it can outlive the calling function.
+// Release must be called after use
+type Lease struct {
+	pool     *PoolClient
+	conn     *clientConn
+	cc       *grpc.ClientConn
+	rank     int // rendezvous rank of the node, see GetConnsForKey
+	released uint32
+}
+
+var _ grpc.ClientConnInterface = &Lease{}
+
+// Lease acquires a connection from the pool, the connection is not closed before the lease is released
+// (or force-closed after the drain timeout when the node leaves the pool)
+func (c *PoolClient) Lease() (*Lease, error) {
+	conn, err := c.acquireNextConn()
+	if err != nil {
+		return nil, err
+	}
+	return c.newLease(conn)
+}
+
+func (c *PoolClient) newLease(conn *clientConn) (*Lease, error) {
+	cc, err := conn.connect()
+	if err != nil {
+		c.releaseConn(conn)
+		c.options.metrics.NodeConnError(conn.nodeName, err)
+		c.recordDialFailure(conn)
+		return nil, err
+	}
+
+	return &Lease{
+		pool: c,
+		conn: conn,
+		cc:   cc,
+	}, nil
+}
+
+// Invoke performs a unary RPC on the leased connection, the result is reported to the circuit breaker
+func (l *Lease) Invoke(ctx context.Context, method string, args interface{}, reply interface{}, opts ...grpc.CallOption) error {
+	err := l.cc.Invoke(ctx, method, args, reply, opts...)
+	l.pool.recordBreakerResult(l.conn, err)
+	return err
+}
+
+// NewStream creates a stream on the leased connection, the result of creating the stream
+// is reported to the circuit breaker
+func (l *Lease) NewStream(
+	ctx context.Context, desc *grpc.StreamDesc, method string, opts ...grpc.CallOption,
+) (grpc.ClientStream, error) {
+	stream, err := l.cc.NewStream(ctx, desc, method, opts...)
+	l.pool.recordBreakerResult(l.conn, err)
+	return stream, err
+}
+
+// Conn returns the underlying connection, calls on it are not reported to the circuit breaker
+func (l *Lease) Conn() *grpc.ClientConn {
+	return l.cc
+}
+
+// NodeName returns the name of the leased node
+func (l *Lease) NodeName() string {
+	return l.conn.nodeName
+}
+
+// Rank returns the rendezvous rank of the node for the key of GetConnsForKey (zero is the primary),
+// always zero for leases of other methods
+func (l *Lease) Rank() int {
+	return l.rank
+}
+
+// Done returns a channel that is closed when the node leaves the pool
+func (l *Lease) Done() <-chan struct{} {
+	return l.conn.doneChan()
+}
+
+// Release returns the connection to the pool, calling it more than once is a no-op
+func (l *Lease) Release() {
+	if atomic.CompareAndSwapUint32(&l.released, 0, 1) {
+		l.pool.releaseConn(l.conn)
+	}
+}
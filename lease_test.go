@@ -0,0 +1,54 @@
+package goblin
+
+import (
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"testing"
+	"unsafe"
+)
+
+func TestPoolClient_Lease_No_Conn(t *testing.T) {
+	pool := makePoolClient(ClientConfig{})
+	lease, err := pool.Lease()
+	assert.Equal(t, ErrNoConn, err)
+	assert.Equal(t, (*Lease)(nil), lease)
+}
+
+func TestPoolClient_Lease_Release(t *testing.T) {
+	cc, err := grpc.Dial("127.0.0.1:5600", grpc.WithInsecure())
+	assert.Equal(t, nil, err)
+
+	conn := &clientConn{
+		conn:     unsafe.Pointer(cc),
+		nodeName: "name-1",
+		refCount: 1,
+		state:    newConnState(),
+	}
+	pool := makePoolClient(ClientConfig{})
+	pool.setClientConns(&clientConns{
+		conns: []*clientConn{conn},
+	})
+
+	lease, err := pool.Lease()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, uint64(2), conn.refCount)
+	assert.Same(t, cc, lease.Conn())
+	assert.Equal(t, "name-1", lease.NodeName())
+
+	// node leaves the pool, connection is kept for the lease
+	removeClientConn(conn, 0)
+	select {
+	case <-lease.Done():
+	default:
+		t.Error("done must be closed")
+	}
+	assert.NotEqual(t, connectivity.Shutdown, cc.GetState())
+
+	lease.Release()
+	assert.Equal(t, uint64(0), conn.refCount)
+	assert.Equal(t, connectivity.Shutdown, cc.GetState())
+
+	lease.Release()
+	assert.Equal(t, uint64(0), conn.refCount)
+}
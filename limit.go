@@ -0,0 +1,172 @@
+package goblin
+
+import (
+	"errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrOverloaded when all nodes reached their in-flight limits or the global limit is reached
+var ErrOverloaded = errors.New("all nodes are overloaded")
+
+// ConcurrencyLimit configures client-side limits of in-flight requests and leases
+type ConcurrencyLimit struct {
+	// GlobalMaxInFlight is the limit over all nodes, zero for unlimited
+	GlobalMaxInFlight int
+
+	// NodeInitialLimit is the initial limit of each node connection, zero disables per-node limits.
+	// The limit is adapted by AIMD: increased by one on success when the node is at least
+	// half-utilized, multiplied by BackoffRatio on overload
+	NodeInitialLimit int
+	NodeMinLimit     int // default 1
+	NodeMaxLimit     int // default 1000
+
+	// LatencyThreshold results slower than this are treated as overload, zero for ignoring latency
+	LatencyThreshold time.Duration
+
+	// BackoffRatio is the multiplicative decrease on overload (default 0.9)
+	BackoffRatio float64
+}
+
+func (c ConcurrencyLimit) withDefaults() ConcurrencyLimit {
+	if c.NodeMinLimit <= 0 {
+		c.NodeMinLimit = 1
+	}
+	if c.NodeMaxLimit <= 0 {
+		c.NodeMaxLimit = 1000
+	}
+	if c.NodeMaxLimit < c.NodeMinLimit {
+		c.NodeMaxLimit = c.NodeMinLimit
+	}
+	if c.BackoffRatio <= 0 || c.BackoffRatio >= 1 {
+		c.BackoffRatio = 0.9
+	}
+	return c
+}
+
+// aimdLimiter is the adaptive in-flight limit of a node connection
+type aimdLimiter struct {
+	conf ConcurrencyLimit
+
+	mu    sync.Mutex
+	limit atomicFloat64 // written under mu, read without lock
+}
+
+func newAIMDLimiter(conf ConcurrencyLimit) *aimdLimiter {
+	l := &aimdLimiter{conf: conf}
+	initial := math.Max(float64(conf.NodeInitialLimit), float64(conf.NodeMinLimit))
+	l.limit.store(math.Min(initial, float64(conf.NodeMaxLimit)))
+	return l
+}
+
+func (l *aimdLimiter) getLimit() uint64 {
+	return uint64(l.limit.load())
+}
+
+// isOverloadResult only errors caused by overload (not application errors) decrease the limit
+func isOverloadResult(err error, latency time.Duration, threshold time.Duration) bool {
+	if threshold > 0 && latency > threshold {
+		return true
+	}
+	switch status.Code(err) {
+	case codes.Unavailable, codes.ResourceExhausted, codes.DeadlineExceeded:
+		return true
+	default:
+		return false
+	}
+}
+
+func (l *aimdLimiter) onResult(inFlight uint64, latency time.Duration, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	limit := l.limit.load()
+	if isOverloadResult(err, latency, l.conf.LatencyThreshold) {
+		limit = math.Max(float64(l.conf.NodeMinLimit), math.Floor(limit*l.conf.BackoffRatio))
+	} else if float64(inFlight*2) >= limit {
+		limit = math.Min(float64(l.conf.NodeMaxLimit), limit+1)
+	}
+	l.limit.store(limit)
+}
+
+func (c *clientConn) getLimiter() *aimdLimiter {
+	if c.state == nil {
+		return nil
+	}
+	return c.state.limiter
+}
+
+// tryAcquire is like acquire but fails with saturated = true when the in-flight limit is reached
+func (c *clientConn) tryAcquire() (ok bool, saturated bool) {
+	var limit uint64
+	if limiter := c.getLimiter(); limiter != nil {
+		limit = limiter.getLimit()
+	}
+
+	for {
+		count := atomic.LoadUint64(&c.refCount)
+		if count == 0 {
+			return false, false
+		}
+		// one reference is of the pool
+		if limit > 0 && count-1 >= limit {
+			return false, true
+		}
+		if atomic.CompareAndSwapUint64(&c.refCount, count, count+1) {
+			return true, false
+		}
+	}
+}
+
+// recordResult adapts the in-flight limit of the connection
+func (c *clientConn) recordResult(latency time.Duration, err error) {
+	limiter := c.getLimiter()
+	if limiter == nil {
+		return
+	}
+
+	inFlight := atomic.LoadUint64(&c.refCount)
+	if inFlight > 0 {
+		inFlight-- // the reference of the pool
+	}
+	limiter.onResult(inFlight, latency, err)
+}
+
+// globalOverloaded is a fast path check before trying the connections
+func (c *PoolClient) globalOverloaded() bool {
+	max := c.options.concurrencyLimit.GlobalMaxInFlight
+	return max > 0 && atomic.LoadInt64(&c.inFlight) >= int64(max)
+}
+
+// tryAcquireGlobal reserves one of the GlobalMaxInFlight slots
+func (c *PoolClient) tryAcquireGlobal() bool {
+	max := int64(c.options.concurrencyLimit.GlobalMaxInFlight)
+	if max <= 0 {
+		return true
+	}
+	for {
+		count := atomic.LoadInt64(&c.inFlight)
+		if count >= max {
+			return false
+		}
+		if atomic.CompareAndSwapInt64(&c.inFlight, count, count+1) {
+			return true
+		}
+	}
+}
+
+func (c *PoolClient) releaseGlobal() {
+	if c.options.concurrencyLimit.GlobalMaxInFlight > 0 {
+		atomic.AddInt64(&c.inFlight, -1)
+	}
+}
+
+// releaseConn releases a connection acquired by tryAcquireConn
+func (c *PoolClient) releaseConn(conn *clientConn) {
+	c.releaseGlobal()
+	releaseAndClose(conn)
+}
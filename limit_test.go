@@ -0,0 +1,166 @@
+package goblin
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"testing"
+	"time"
+)
+
+func newTestLimitedConn(name string, conf ConcurrencyLimit) *clientConn {
+	conn := &clientConn{nodeName: name, refCount: 1, state: newConnState()}
+	conn.state.limiter = newAIMDLimiter(conf.withDefaults())
+	return conn
+}
+
+func TestConcurrencyLimit_WithDefaults(t *testing.T) {
+	assert.Equal(t, ConcurrencyLimit{
+		NodeMinLimit: 1,
+		NodeMaxLimit: 1000,
+		BackoffRatio: 0.9,
+	}, ConcurrencyLimit{}.withDefaults())
+
+	assert.Equal(t, ConcurrencyLimit{
+		NodeMinLimit: 20,
+		NodeMaxLimit: 20,
+		BackoffRatio: 0.5,
+	}, ConcurrencyLimit{NodeMinLimit: 20, NodeMaxLimit: 10, BackoffRatio: 0.5}.withDefaults())
+}
+
+func TestIsOverloadResult(t *testing.T) {
+	assert.Equal(t, false, isOverloadResult(nil, time.Second, 0))
+	assert.Equal(t, true, isOverloadResult(nil, time.Second, 500*time.Millisecond))
+	assert.Equal(t, false, isOverloadResult(errors.New("some error"), 0, 0))
+	assert.Equal(t, false, isOverloadResult(status.Error(codes.NotFound, "not found"), 0, 0))
+	assert.Equal(t, true, isOverloadResult(status.Error(codes.Unavailable, "unavailable"), 0, 0))
+	assert.Equal(t, true, isOverloadResult(status.Error(codes.ResourceExhausted, "exhausted"), 0, 0))
+	assert.Equal(t, true, isOverloadResult(status.Error(codes.DeadlineExceeded, "deadline"), 0, 0))
+}
+
+func TestAIMDLimiter(t *testing.T) {
+	l := newAIMDLimiter(ConcurrencyLimit{NodeInitialLimit: 10, NodeMaxLimit: 11}.withDefaults())
+	assert.Equal(t, uint64(10), l.getLimit())
+
+	// not utilized enough
+	l.onResult(4, time.Millisecond, nil)
+	assert.Equal(t, uint64(10), l.getLimit())
+
+	l.onResult(5, time.Millisecond, nil)
+	assert.Equal(t, uint64(11), l.getLimit())
+
+	l.onResult(10, time.Millisecond, nil)
+	assert.Equal(t, uint64(11), l.getLimit())
+
+	l.onResult(1, time.Millisecond, status.Error(codes.Unavailable, "unavailable"))
+	assert.Equal(t, uint64(9), l.getLimit())
+
+	for i := 0; i < 50; i++ {
+		l.onResult(1, time.Millisecond, status.Error(codes.Unavailable, "unavailable"))
+	}
+	assert.Equal(t, uint64(1), l.getLimit())
+}
+
+func TestClientConn_TryAcquire(t *testing.T) {
+	conn := newTestLimitedConn("name-1", ConcurrencyLimit{NodeInitialLimit: 2})
+
+	ok, saturated := conn.tryAcquire()
+	assert.Equal(t, true, ok)
+	assert.Equal(t, false, saturated)
+
+	ok, saturated = conn.tryAcquire()
+	assert.Equal(t, true, ok)
+	assert.Equal(t, false, saturated)
+
+	ok, saturated = conn.tryAcquire()
+	assert.Equal(t, false, ok)
+	assert.Equal(t, true, saturated)
+	assert.Equal(t, uint64(3), conn.refCount)
+
+	conn.release()
+	ok, _ = conn.tryAcquire()
+	assert.Equal(t, true, ok)
+
+	removed := &clientConn{nodeName: "name-2"}
+	ok, saturated = removed.tryAcquire()
+	assert.Equal(t, false, ok)
+	assert.Equal(t, false, saturated)
+
+	// without limiter
+	unlimited := &clientConn{nodeName: "name-3", refCount: 100}
+	ok, _ = unlimited.tryAcquire()
+	assert.Equal(t, true, ok)
+}
+
+func TestPoolClient_AcquireNextConn_Overloaded(t *testing.T) {
+	conf := ConcurrencyLimit{NodeInitialLimit: 1}
+	conn1 := newTestLimitedConn("name-1", conf)
+	conn2 := newTestLimitedConn("name-2", conf)
+
+	pool := makePoolClient(ClientConfig{}, WithConcurrencyLimit(conf))
+	pool.setClientConns(&clientConns{conns: []*clientConn{conn1, conn2}})
+
+	result, err := pool.acquireNextConn()
+	assert.Equal(t, nil, err)
+	assert.Same(t, conn1, result)
+
+	// skip the saturated node
+	result, err = pool.acquireNextConn()
+	assert.Equal(t, nil, err)
+	assert.Same(t, conn2, result)
+
+	_, err = pool.acquireNextConn()
+	assert.Equal(t, ErrOverloaded, err)
+
+	_, err = pool.acquireConnByName("name-1")
+	assert.Equal(t, ErrOverloaded, err)
+
+	conn1.release()
+	result, err = pool.acquireNextConn()
+	assert.Equal(t, nil, err)
+	assert.Same(t, conn1, result)
+}
+
+func TestPoolClient_AcquireNextConn_Global_Limit(t *testing.T) {
+	conn1 := &clientConn{nodeName: "name-1", refCount: 1}
+	conn2 := &clientConn{nodeName: "name-2", refCount: 1}
+
+	pool := makePoolClient(ClientConfig{}, WithConcurrencyLimit(ConcurrencyLimit{GlobalMaxInFlight: 3}))
+	pool.setClientConns(&clientConns{conns: []*clientConn{conn1, conn2}})
+
+	for i := 0; i < 3; i++ {
+		_, err := pool.acquireNextConn()
+		assert.Equal(t, nil, err)
+	}
+
+	_, err := pool.acquireNextConn()
+	assert.Equal(t, ErrOverloaded, err)
+	_, err = pool.acquireConnByName("name-1")
+	assert.Equal(t, ErrOverloaded, err)
+
+	pool.releaseConn(conn2)
+	assert.Equal(t, int64(2), pool.inFlight)
+	_, err = pool.acquireNextConn()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, int64(3), pool.inFlight)
+}
+
+func TestPoolClient_GetConn_Adapt_Limit(t *testing.T) {
+	pool, conn := newFakeServerPoolClient(t)
+	conn.state.limiter = newAIMDLimiter(ConcurrencyLimit{NodeInitialLimit: 10}.withDefaults())
+
+	err := pool.GetConn(func(conn *grpc.ClientConn) error {
+		return status.Error(codes.ResourceExhausted, "exhausted")
+	})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.Equal(t, uint64(9), conn.state.limiter.getLimit())
+
+	// streams are not used for adapting
+	err = pool.GetConnStream(func(cc *grpc.ClientConn, done <-chan struct{}) error {
+		return status.Error(codes.Unavailable, "unavailable")
+	})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.Equal(t, uint64(9), conn.state.limiter.getLimit())
+}
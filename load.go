@@ -0,0 +1,134 @@
+package goblin
+
+import (
+	"context"
+	"github.com/QuangTung97/goblin/goblinpb"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// atomicFloat64 stores the bits of a float64 for lock-free access
+type atomicFloat64 struct {
+	bits uint64
+}
+
+func (f *atomicFloat64) load() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&f.bits))
+}
+
+func (f *atomicFloat64) store(v float64) {
+	atomic.StoreUint64(&f.bits, math.Float64bits(v))
+}
+
+func encodeNodeMeta(meta *goblinpb.NodeMeta) []byte {
+	data, err := proto.Marshal(meta)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// decodeNodeMeta returns an empty meta for nodes of older versions or invalid data
+func decodeNodeMeta(data []byte) *goblinpb.NodeMeta {
+	meta := &goblinpb.NodeMeta{}
+	if err := proto.Unmarshal(data, meta); err != nil {
+		return &goblinpb.NodeMeta{}
+	}
+	return meta
+}
+
+// SetLoad sets the load score of the current node, lower is less loaded.
+// The score is published to the cluster through memberlist metadata every load report interval,
+// if it changed more than the load report threshold
+func (s *PoolServer) SetLoad(load float64) {
+	s.load.store(load)
+}
+
+// GetLoad returns the load score of the current node
+func (s *PoolServer) GetLoad() float64 {
+	return s.load.load()
+}
+
+// loadChanged reports whether the load changed enough from the published load to be published
+func loadChanged(published, load, threshold float64) bool {
+	if load == published {
+		return false
+	}
+	if threshold <= 0 {
+		return true
+	}
+	return math.Abs(load-published) >= threshold*math.Max(math.Abs(published), 1)
+}
+
+func (s *PoolServer) runLoadReporter() {
+	ticker := time.NewTicker(s.options.loadReportInterval)
+	defer ticker.Stop()
+
+	published := s.load.load()
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.ctx.Done():
+			return
+		}
+
+		if s.options.loadFunc != nil {
+			s.load.store(s.options.loadFunc())
+		}
+
+		load := s.load.load()
+		if !loadChanged(published, load, s.options.loadThreshold) {
+			continue
+		}
+
+		err := s.m.UpdateNode(s.options.loadReportInterval)
+		if err != nil {
+			s.options.logger.Warn("UpdateNode", zap.Error(err))
+			continue
+		}
+		published = load
+	}
+}
+
+// InFlightCounter counts the in-flight gRPC requests of a server, can be used as a load score:
+//
+//	counter := &goblin.InFlightCounter{}
+//	server := grpc.NewServer(
+//		grpc.ChainUnaryInterceptor(counter.UnaryServerInterceptor()),
+//		grpc.ChainStreamInterceptor(counter.StreamServerInterceptor()),
+//	)
+//	pool, err := goblin.NewPoolServer(conf, goblin.WithLoadFunc(counter.Load))
+type InFlightCounter struct {
+	count int64
+}
+
+// Load returns the number of in-flight requests
+func (c *InFlightCounter) Load() float64 {
+	return float64(atomic.LoadInt64(&c.count))
+}
+
+// UnaryServerInterceptor counts unary requests
+func (c *InFlightCounter) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		atomic.AddInt64(&c.count, 1)
+		defer atomic.AddInt64(&c.count, -1)
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor counts streams
+func (c *InFlightCounter) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(
+		srv interface{}, stream grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler,
+	) error {
+		atomic.AddInt64(&c.count, 1)
+		defer atomic.AddInt64(&c.count, -1)
+		return handler(srv, stream)
+	}
+}
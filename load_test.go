@@ -0,0 +1,193 @@
+package goblin
+
+import (
+	"context"
+	"github.com/QuangTung97/goblin/goblinpb"
+	"github.com/hashicorp/memberlist"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestEncodeDecodeNodeMeta(t *testing.T) {
+	meta := decodeNodeMeta(encodeNodeMeta(&goblinpb.NodeMeta{Load: 2.5}))
+	assert.Equal(t, 2.5, meta.Load)
+
+	meta = decodeNodeMeta(encodeNodeMeta(&goblinpb.NodeMeta{Load: 1.5, GrpcAddr: "address-1:4001"}))
+	assert.Equal(t, 1.5, meta.Load)
+	assert.Equal(t, "address-1:4001", meta.GrpcAddr)
+
+	meta = decodeNodeMeta(nil)
+	assert.Equal(t, 0.0, meta.Load)
+
+	meta = decodeNodeMeta([]byte{0xff, 0xff})
+	assert.Equal(t, 0.0, meta.Load)
+}
+
+func TestDelegate_NodeMeta(t *testing.T) {
+	d := newDelegate(newNodeMap(30 * time.Second))
+	assert.Equal(t, []byte(nil), d.NodeMeta(memberlist.MetaMaxSize))
+
+	d.load = &atomicFloat64{}
+	d.load.store(3.5)
+	assert.Equal(t, 3.5, decodeNodeMeta(d.NodeMeta(memberlist.MetaMaxSize)).Load)
+	assert.Equal(t, []byte(nil), d.NodeMeta(2))
+
+	d.setGRPCAddr("address-1:4001")
+	meta := decodeNodeMeta(d.NodeMeta(memberlist.MetaMaxSize))
+	assert.Equal(t, 3.5, meta.Load)
+	assert.Equal(t, "address-1:4001", meta.GrpcAddr)
+}
+
+func TestEventDelegate_NotifyJoin_GRPCAddr(t *testing.T) {
+	n := newNodeMap(30 * time.Second)
+	d := newEventDelegate(n)
+
+	d.NotifyJoin(&memberlist.Node{
+		Name: "name-1",
+		Addr: net.ParseIP("127.0.0.1"),
+		Port: 7946,
+		Meta: encodeNodeMeta(&goblinpb.NodeMeta{GrpcAddr: "10.0.0.1:4001"}),
+	})
+
+	_, nodes := n.getNodes()
+	assert.Equal(t, map[string]Node{
+		"name-1": {Addr: "127.0.0.1:7946", GRPCAddr: "10.0.0.1:4001"},
+	}, nodes)
+
+	result := nodesToNodeList(1, nodes)
+	assert.Equal(t, []*goblinpb.Node{
+		{Name: "name-1", Addr: "127.0.0.1:7946", GrpcAddr: "10.0.0.1:4001"},
+	}, result.Nodes)
+}
+
+func TestLoadChanged(t *testing.T) {
+	assert.Equal(t, false, loadChanged(10, 10, 0.1))
+	assert.Equal(t, false, loadChanged(10, 10.5, 0.1))
+	assert.Equal(t, true, loadChanged(10, 11, 0.1))
+	assert.Equal(t, true, loadChanged(10, 9, 0.1))
+
+	// absolute for loads below 1
+	assert.Equal(t, false, loadChanged(0, 0.05, 0.1))
+	assert.Equal(t, true, loadChanged(0, 0.1, 0.1))
+	assert.Equal(t, true, loadChanged(0.5, 0.3, 0.1))
+
+	// zero threshold publishes every change
+	assert.Equal(t, true, loadChanged(10, 10.5, 0))
+	assert.Equal(t, false, loadChanged(10, 10, 0))
+}
+
+func TestEventDelegate_NotifyUpdate_Load(t *testing.T) {
+	n := newNodeMap(30 * time.Second)
+	d := newEventDelegate(n)
+
+	node := &memberlist.Node{
+		Name: "name-1",
+		Addr: net.ParseIP("127.0.0.1"),
+		Port: 7946,
+		Meta: encodeNodeMeta(&goblinpb.NodeMeta{Load: 1.5}),
+	}
+	d.NotifyJoin(node)
+
+	seq, nodes := n.getNodes()
+	assert.Equal(t, uint64(1), seq)
+	assert.Equal(t, map[string]Node{
+		"name-1": {Addr: "127.0.0.1:7946", Load: 1.5},
+	}, nodes)
+
+	// same metadata
+	d.NotifyUpdate(node)
+	seq, _ = n.getNodes()
+	assert.Equal(t, uint64(1), seq)
+
+	node.Meta = encodeNodeMeta(&goblinpb.NodeMeta{Load: 4})
+	d.NotifyUpdate(node)
+	seq, nodes = n.getNodes()
+	assert.Equal(t, uint64(2), seq)
+	assert.Equal(t, map[string]Node{
+		"name-1": {Addr: "127.0.0.1:7946", Load: 4},
+	}, nodes)
+}
+
+func TestNodesToNodeList_Load(t *testing.T) {
+	result := nodesToNodeList(3, map[string]Node{
+		"name-1": {Addr: "address-1", Load: 0.5},
+	})
+	assert.Equal(t, []*goblinpb.Node{
+		{Name: "name-1", Addr: "address-1", Load: 0.5},
+	}, result.Nodes)
+}
+
+func TestInFlightCounter(t *testing.T) {
+	counter := &InFlightCounter{}
+	interceptor := counter.UnaryServerInterceptor()
+
+	var inHandler float64
+	_, err := interceptor(context.Background(), nil, &grpc.UnaryServerInfo{},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			inHandler = counter.Load()
+			return nil, nil
+		})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1.0, inHandler)
+	assert.Equal(t, 0.0, counter.Load())
+
+	err = counter.StreamServerInterceptor()(nil, nil, &grpc.StreamServerInfo{},
+		func(srv interface{}, stream grpc.ServerStream) error {
+			inHandler = counter.Load()
+			return nil
+		})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1.0, inHandler)
+	assert.Equal(t, 0.0, counter.Load())
+}
+
+func TestLessLoadedIndex(t *testing.T) {
+	newConn := func(load float64) *clientConn {
+		conn := &clientConn{state: newConnState()}
+		conn.setLoad(load)
+		return conn
+	}
+
+	conns := []*clientConn{newConn(5), newConn(1)}
+	for seq := uint64(1); seq < 10; seq++ {
+		assert.Equal(t, uint64(1), lessLoadedIndex(conns, 0, seq))
+		assert.Equal(t, uint64(1), lessLoadedIndex(conns, 1, seq))
+	}
+
+	assert.Equal(t, uint64(0), lessLoadedIndex(conns[:1], 0, 1))
+
+	// equal loads keep the round-robin candidate
+	conns = []*clientConn{newConn(2), newConn(2), newConn(2)}
+	assert.Equal(t, uint64(2), lessLoadedIndex(conns, 2, 7))
+}
+
+func TestPoolClient_GetNextConn_Load_Aware(t *testing.T) {
+	nodes := []*goblinpb.Node{
+		{Name: "name-1", Addr: "127.0.0.1:5800", Load: 10},
+		{Name: "name-2", Addr: "127.0.0.1:5801", Load: 1},
+	}
+
+	factory := newTestConnFactory(nil)
+	factory.lazyConnect = true
+	conns, _ := computeNewClientConns(nil, nodes, factory)
+
+	pool := makePoolClient(ClientConfig{}, WithLoadAwareBalancing())
+	pool.setClientConns(conns)
+
+	for i := 0; i < 4; i++ {
+		conn, ok := pool.getNextConn()
+		assert.Equal(t, true, ok)
+		assert.Equal(t, "name-2", conn.nodeName)
+	}
+
+	// loads of existing connections are updated
+	nodes[0].Load = 0
+	conns, _ = computeNewClientConns(conns, nodes, factory)
+	pool.setClientConns(conns)
+
+	conn, _ := pool.getNextConn()
+	assert.Equal(t, "name-1", conn.nodeName)
+}
@@ -0,0 +1,58 @@
+package goblin
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// memberCache is the on-disk format of the last known member addresses
+type memberCache struct {
+	Addresses []string `json:"addresses"`
+}
+
+func loadMemberCache(path string) ([]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cache memberCache
+	err = json.Unmarshal(data, &cache)
+	if err != nil {
+		return nil, err
+	}
+	return cache.Addresses, nil
+}
+
+func saveMemberCache(path string, addrs []string) error {
+	data, err := json.Marshal(memberCache{Addresses: addrs})
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+// writeFileAtomic writes to a temporary file then renames it, readers never see a partial file
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+
+	_, err = tmp.Write(data)
+	if err != nil {
+		_ = tmp.Close()
+		return err
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
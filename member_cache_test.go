@@ -0,0 +1,30 @@
+package goblin
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSaveLoadMemberCache(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "members.json")
+
+	err := saveMemberCache(path, []string{"address-1", "address-2"})
+	assert.Equal(t, nil, err)
+
+	addrs, err := loadMemberCache(path)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{"address-1", "address-2"}, addrs)
+
+	files, err := ioutil.ReadDir(dir)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(files))
+}
+
+func TestLoadMemberCache_Not_Existed(t *testing.T) {
+	_, err := loadMemberCache(filepath.Join(t.TempDir(), "members.json"))
+	assert.Equal(t, true, os.IsNotExist(err))
+}
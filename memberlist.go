@@ -1,14 +1,24 @@
 package goblin
 
 import (
-	"fmt"
+	"github.com/QuangTung97/goblin/goblinpb"
 	"github.com/hashicorp/memberlist"
+	"net"
+	"sort"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"unsafe"
 )
 
 type delegate struct {
 	nodes      *nodeMap
 	broadcasts *memberlist.TransmitLimitedQueue
+	load       *atomicFloat64 // load of the current node, nil in tests
+	messages   *messageBus    // nil in tests
+	kv         *KVStore       // nil in tests
+	grpcAddr   unsafe.Pointer // *string, the advertised gRPC address of the current node
+	instance   string         // the instance of the current node
 }
 
 var _ memberlist.Delegate = &delegate{}
@@ -20,16 +30,52 @@ func newDelegate(nodes *nodeMap) *delegate {
 }
 
 func (d *delegate) NodeMeta(limit int) []byte {
-	return nil
+	if d.load == nil {
+		return nil
+	}
+	data := encodeNodeMeta(&goblinpb.NodeMeta{
+		Load:     d.load.load(),
+		GrpcAddr: d.getGRPCAddr(),
+		Instance: d.instance,
+	})
+	if len(data) > limit {
+		return nil
+	}
+	return data
+}
+
+func (d *delegate) getGRPCAddr() string {
+	addr := (*string)(atomic.LoadPointer(&d.grpcAddr))
+	if addr == nil {
+		return ""
+	}
+	return *addr
+}
+
+func (d *delegate) setGRPCAddr(addr string) {
+	atomic.StorePointer(&d.grpcAddr, unsafe.Pointer(&addr))
 }
 
 func (d *delegate) NotifyMsg(msg []byte) {
+	if isAppMessage(msg) {
+		if d.messages != nil {
+			d.messages.receive(msg)
+		}
+		return
+	}
+	if hasPrefix(msg, kvMessagePrefix) {
+		if d.kv != nil {
+			d.kv.receive(msg)
+		}
+		return
+	}
+
 	b, ok := unmarshalBroadcast(msg)
 	if !ok {
 		return
 	}
 
-	continued := d.nodes.nodeGracefulLeave(b.name, b.addr)
+	continued := d.nodes.nodeGracefulLeaveInstance(b.name, b.addr, b.instance)
 	if continued {
 		d.broadcasts.QueueBroadcast(b)
 	}
@@ -39,22 +85,36 @@ func (d *delegate) GetBroadcasts(overhead, limit int) [][]byte {
 	return d.broadcasts.GetBroadcasts(overhead, limit)
 }
 
-func computeLeftNodesState(nodes *nodeMap) []byte {
+func computeLocalState(nodes *nodeMap, kv *KVStore) *goblinpb.LocalState {
 	leftNodes := nodes.getLeftNodes()
 
-	result := make([]string, 0, len(leftNodes))
+	result := &goblinpb.LocalState{
+		LeftNodes: make([]*goblinpb.LeftNode, 0, len(leftNodes)),
+	}
 	for name, node := range leftNodes {
-		b := marshalBroadcast(broadcast{
-			name: name,
-			addr: node.addr,
+		result.LeftNodes = append(result.LeftNodes, &goblinpb.LeftNode{
+			Name:     name,
+			Addr:     node.addr,
+			Instance: node.instance,
 		})
-		result = append(result, string(b))
 	}
-	return []byte(strings.Join(result, ","))
+	sort.Slice(result.LeftNodes, func(i, j int) bool {
+		return result.LeftNodes[i].Name < result.LeftNodes[j].Name
+	})
+
+	if kv != nil {
+		result.KvEntries = kv.getEntries()
+	}
+	return result
 }
 
+// LocalState older nodes can not parse this format, they only miss the left nodes of newer ones
 func (d *delegate) LocalState(bool) []byte {
-	return computeLeftNodesState(d.nodes)
+	data, err := marshalPrefixed(localStatePrefix, computeLocalState(d.nodes, d.kv))
+	if err != nil {
+		return nil
+	}
+	return data
 }
 
 func remoteStateToBroadcast(s []byte) []broadcast {
@@ -73,14 +133,36 @@ func remoteStateToBroadcast(s []byte) []broadcast {
 	return result
 }
 
+// remoteStateToLocalState also accepts the legacy format "name@addr,name@addr" of older nodes
+func remoteStateToLocalState(s []byte) *goblinpb.LocalState {
+	result := &goblinpb.LocalState{}
+	if unmarshalPrefixed(localStatePrefix, s, result) {
+		return result
+	}
+
+	result = &goblinpb.LocalState{}
+	for _, b := range remoteStateToBroadcast(s) {
+		result.LeftNodes = append(result.LeftNodes, &goblinpb.LeftNode{
+			Name: b.name,
+			Addr: b.addr,
+		})
+	}
+	return result
+}
+
 func (d *delegate) MergeRemoteState(buf []byte, _ bool) {
-	list := remoteStateToBroadcast(buf)
-	for _, b := range list {
-		continued := d.nodes.nodeGracefulLeave(b.name, b.addr)
+	state := remoteStateToLocalState(buf)
+	for _, node := range state.LeftNodes {
+		b := broadcast{name: node.Name, addr: node.Addr, instance: node.Instance}
+		continued := d.nodes.nodeGracefulLeaveInstance(b.name, b.addr, b.instance)
 		if continued {
 			d.broadcasts.QueueBroadcast(b)
 		}
 	}
+
+	if d.kv != nil {
+		d.kv.mergeEntries(state.KvEntries)
+	}
 }
 
 type eventDelegate struct {
@@ -96,25 +178,37 @@ func newEventDelegate(nodes *nodeMap) *eventDelegate {
 }
 
 func nodeToAddr(n *memberlist.Node) string {
-	return fmt.Sprintf("%v:%d", n.Addr, n.Port)
+	return net.JoinHostPort(n.Addr.String(), strconv.Itoa(int(n.Port)))
+}
+
+func memberlistNodeToNode(n *memberlist.Node) Node {
+	meta := decodeNodeMeta(n.Meta)
+	return Node{
+		Addr:     nodeToAddr(n),
+		Load:     meta.Load,
+		GRPCAddr: meta.GrpcAddr,
+		Instance: meta.Instance,
+	}
 }
 
 func (d *eventDelegate) NotifyJoin(n *memberlist.Node) {
-	d.nodes.nodeJoin(n.Name, nodeToAddr(n))
+	d.nodes.nodeUpsert(n.Name, memberlistNodeToNode(n))
 }
 
 func (d *eventDelegate) NotifyLeave(n *memberlist.Node) {
 	d.nodes.nodeLeave(n.Name)
 }
 
-func (d *eventDelegate) NotifyUpdate(*memberlist.Node) {
+func (d *eventDelegate) NotifyUpdate(n *memberlist.Node) {
+	d.nodes.nodeUpsert(n.Name, memberlistNodeToNode(n))
 }
 
 var _ memberlist.EventDelegate = &eventDelegate{}
 
 type broadcast struct {
-	name string
-	addr string
+	name     string
+	addr     string
+	instance string // empty for broadcasts of older nodes
 }
 
 var _ memberlist.NamedBroadcast = broadcast{}
@@ -138,8 +232,12 @@ func (b broadcast) Name() string {
 	return b.name
 }
 
+// marshalBroadcast the format is "name@addr@instance", older nodes only read "name@addr"
 func marshalBroadcast(b broadcast) []byte {
-	return []byte(b.name + "@" + b.addr)
+	if b.instance == "" {
+		return []byte(b.name + "@" + b.addr)
+	}
+	return []byte(b.name + "@" + b.addr + "@" + b.instance)
 }
 
 func unmarshalBroadcast(msg []byte) (broadcast, bool) {
@@ -148,10 +246,12 @@ func unmarshalBroadcast(msg []byte) (broadcast, bool) {
 		return broadcast{}, false
 	}
 
-	name := values[0]
-	addr := values[1]
-	return broadcast{
-		name: name,
-		addr: addr,
-	}, true
+	b := broadcast{
+		name: values[0],
+		addr: values[1],
+	}
+	if len(values) > 2 {
+		b.instance = values[2]
+	}
+	return b, true
 }
@@ -1,7 +1,11 @@
 package goblin
 
 import (
+	"github.com/QuangTung97/goblin/goblinpb"
+	"github.com/hashicorp/memberlist"
 	"github.com/stretchr/testify/assert"
+	"net"
+	"sort"
 	"testing"
 	"time"
 )
@@ -15,24 +19,126 @@ func TestMarshalUnmarshalBroadcast(t *testing.T) {
 	assert.Equal(t, b, b1)
 }
 
-func TestComputeLeftNodesState(t *testing.T) {
+func TestMarshalUnmarshalBroadcast_Instance(t *testing.T) {
+	b := broadcast{name: "name-1", addr: "address-1", instance: "instance-1"}
+	result := marshalBroadcast(b)
+	assert.Equal(t, "name-1@address-1@instance-1", string(result))
+	b1, ok := unmarshalBroadcast(result)
+	assert.Equal(t, true, ok)
+	assert.Equal(t, b, b1)
+}
+
+func TestComputeLocalState(t *testing.T) {
 	n := newNodeMap(30 * time.Second)
 	n.nodeJoin("name-1", "address-1")
 	n.nodeJoin("name-2", "address-2")
-	n.nodeGracefulLeave("name-1", "address-1")
 	n.nodeGracefulLeave("name-2", "address-2")
+	n.nodeGracefulLeave("name-1", "address-1")
+
+	result := computeLocalState(n, nil)
+	assert.Equal(t, []*goblinpb.LeftNode{
+		{Name: "name-1", Addr: "address-1"},
+		{Name: "name-2", Addr: "address-2"},
+	}, result.LeftNodes)
+}
+
+func TestComputeLocalState_Instance(t *testing.T) {
+	n := newNodeMap(30 * time.Second)
+	n.nodeUpsert("name-1", Node{Addr: "address-1", Instance: "instance-1"})
+	n.nodeGracefulLeave("name-1", "address-1")
+
+	result := computeLocalState(n, nil)
+	assert.Equal(t, []*goblinpb.LeftNode{
+		{Name: "name-1", Addr: "address-1", Instance: "instance-1"},
+	}, result.LeftNodes)
+}
+
+func TestDelegate_MergeRemoteState_Previous_Instance(t *testing.T) {
+	n := newNodeMap(30 * time.Second)
+	n.nodeUpsert("name-1", Node{Addr: "address-1", Instance: "instance-2"})
+
+	d := newDelegate(n)
+	d.broadcasts = &memberlist.TransmitLimitedQueue{
+		NumNodes:       func() int { return 1 },
+		RetransmitMult: 1,
+	}
+
+	data, err := marshalPrefixed(localStatePrefix, &goblinpb.LocalState{
+		LeftNodes: []*goblinpb.LeftNode{
+			{Name: "name-1", Addr: "address-1", Instance: "instance-1"},
+			{Name: "name-2", Addr: "address-2", Instance: "instance-3"},
+		},
+	})
+	assert.Equal(t, nil, err)
 
-	result := computeLeftNodesState(n)
-	s := string(result)
-	if s != "name-1@address-1,name-2@address-2" && s != "name-2@address-2,name-1@address-1" {
-		t.Error("computeLeftNodesState error", s)
+	d.MergeRemoteState(data, false)
+	assert.Equal(t, []string{"name-2"}, sortedLeftNames(n))
+}
+
+func TestDelegate_NotifyMsg_Late_Leave_Of_Previous_Instance(t *testing.T) {
+	n := newNodeMap(30 * time.Second)
+	n.nodeUpsert("name-1", Node{Addr: "address-1", Instance: "instance-2"})
+
+	d := newDelegate(n)
+	d.broadcasts = &memberlist.TransmitLimitedQueue{
+		NumNodes:       func() int { return 1 },
+		RetransmitMult: 1,
 	}
+
+	// the leave of the instance before restarting arrives after the restart
+	d.NotifyMsg(marshalBroadcast(broadcast{name: "name-1", addr: "address-1", instance: "instance-1"}))
+	assert.Equal(t, []string(nil), sortedLeftNames(n))
+	assert.Equal(t, 0, d.broadcasts.NumQueued())
+
+	d.NotifyMsg(marshalBroadcast(broadcast{name: "name-1", addr: "address-1", instance: "instance-2"}))
+	assert.Equal(t, []string{"name-1"}, sortedLeftNames(n))
+	assert.Equal(t, 1, d.broadcasts.NumQueued())
 }
 
-func TestComputeLeftNodesState_Empty(t *testing.T) {
+func sortedLeftNames(n *nodeMap) []string {
+	var names []string
+	for name := range n.getLeftNodes() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestComputeLocalState_Empty(t *testing.T) {
 	n := newNodeMap(30 * time.Second)
-	result := computeLeftNodesState(n)
-	assert.Equal(t, "", string(result))
+	result := computeLocalState(n, nil)
+	assert.Equal(t, 0, len(result.LeftNodes))
+	assert.Equal(t, 0, len(result.KvEntries))
+}
+
+func TestRemoteStateToLocalState(t *testing.T) {
+	t.Run("legacy", func(t *testing.T) {
+		result := remoteStateToLocalState([]byte("name-1@address-1,name-2@address-2"))
+		assert.Equal(t, []*goblinpb.LeftNode{
+			{Name: "name-1", Addr: "address-1"},
+			{Name: "name-2", Addr: "address-2"},
+		}, result.LeftNodes)
+	})
+
+	t.Run("legacy empty", func(t *testing.T) {
+		result := remoteStateToLocalState(nil)
+		assert.Equal(t, 0, len(result.LeftNodes))
+	})
+
+	t.Run("versioned", func(t *testing.T) {
+		n := newNodeMap(30 * time.Second)
+		n.nodeGracefulLeave("name-1", "address-1")
+
+		d := newDelegate(n)
+		data := d.LocalState(false)
+
+		// older nodes ignore it
+		assert.Equal(t, []broadcast(nil), remoteStateToBroadcast(data))
+
+		result := remoteStateToLocalState(data)
+		assert.Equal(t, "name-1", result.LeftNodes[0].Name)
+		assert.Equal(t, "address-1", result.LeftNodes[0].Addr)
+	})
 }
 
 func TestRemoteStateToBroadcast(t *testing.T) {
@@ -55,3 +161,14 @@ func TestRemoteStateToBroadcast(t *testing.T) {
 		}, result)
 	})
 }
+
+func TestNodeToAddr(t *testing.T) {
+	assert.Equal(t, "127.0.0.1:7946", nodeToAddr(&memberlist.Node{
+		Addr: net.ParseIP("127.0.0.1"),
+		Port: 7946,
+	}))
+	assert.Equal(t, "[fd00::2]:7946", nodeToAddr(&memberlist.Node{
+		Addr: net.ParseIP("fd00::2"),
+		Port: 7946,
+	}))
+}
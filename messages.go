@@ -0,0 +1,252 @@
+package goblin
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"github.com/QuangTung97/goblin/goblinpb"
+	"github.com/google/uuid"
+	"github.com/hashicorp/memberlist"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+	"sync"
+)
+
+// ErrMessageTooLarge when the encoded message does not fit in a gossip packet
+var ErrMessageTooLarge = errors.New("gossip message is too large")
+
+// MessageHandler handles the messages of a topic, from is the name of the node that broadcast the message
+type MessageHandler func(from string, payload []byte)
+
+// Prefixes of messages and push/pull states, the body is base64 encoded. It never contains
+// '@' or ',' so that older nodes ignore it instead of parsing leave broadcasts
+const (
+	appMessagePrefix byte = 0x01
+	kvMessagePrefix  byte = 0x02
+	localStatePrefix byte = 0x03
+)
+
+const (
+	// messageOverhead reserved for memberlist headers (compound, label, encryption)
+	messageOverhead = 128
+
+	messageDedupSize    = 4096
+	messageDispatchSize = 256
+)
+
+func hasPrefix(msg []byte, prefix byte) bool {
+	return len(msg) > 0 && msg[0] == prefix
+}
+
+func marshalPrefixed(prefix byte, msg proto.Message) ([]byte, error) {
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]byte, 1+base64.RawStdEncoding.EncodedLen(len(data)))
+	result[0] = prefix
+	base64.RawStdEncoding.Encode(result[1:], data)
+	return result, nil
+}
+
+func unmarshalPrefixed(prefix byte, msg []byte, result proto.Message) bool {
+	if !hasPrefix(msg, prefix) {
+		return false
+	}
+
+	data, err := base64.RawStdEncoding.DecodeString(string(msg[1:]))
+	if err != nil {
+		return false
+	}
+	return proto.Unmarshal(data, result) == nil
+}
+
+func isAppMessage(msg []byte) bool {
+	return hasPrefix(msg, appMessagePrefix)
+}
+
+func marshalAppMessage(msg *goblinpb.GossipMessage) ([]byte, error) {
+	return marshalPrefixed(appMessagePrefix, msg)
+}
+
+func unmarshalAppMessage(msg []byte) (*goblinpb.GossipMessage, bool) {
+	result := &goblinpb.GossipMessage{}
+	if !unmarshalPrefixed(appMessagePrefix, msg, result) || len(result.Id) == 0 {
+		return nil, false
+	}
+	return result, true
+}
+
+// appBroadcast is an unnamed broadcast, it never invalidates others
+type appBroadcast struct {
+	msg []byte
+}
+
+var _ memberlist.Broadcast = appBroadcast{}
+
+func (b appBroadcast) Invalidates(memberlist.Broadcast) bool {
+	return false
+}
+
+func (b appBroadcast) Message() []byte {
+	return b.msg
+}
+
+func (b appBroadcast) Finished() {
+}
+
+// seenCache remembers the most recent message ids, the oldest is evicted when full
+type seenCache struct {
+	ids   map[string]struct{}
+	order []string
+	next  int
+}
+
+func newSeenCache(size int) *seenCache {
+	return &seenCache{
+		ids:   map[string]struct{}{},
+		order: make([]string, 0, size),
+	}
+}
+
+// add returns false if the id has already been seen
+func (c *seenCache) add(id string) bool {
+	if _, existed := c.ids[id]; existed {
+		return false
+	}
+
+	if len(c.order) < cap(c.order) {
+		c.order = append(c.order, id)
+	} else {
+		delete(c.ids, c.order[c.next])
+		c.order[c.next] = id
+		c.next = (c.next + 1) % len(c.order)
+	}
+	c.ids[id] = struct{}{}
+	return true
+}
+
+type messageBus struct {
+	name    string
+	maxSize int
+	logger  *zap.Logger
+
+	broadcasts *memberlist.TransmitLimitedQueue
+
+	mu       sync.Mutex
+	handlers map[string]MessageHandler
+	seen     *seenCache
+
+	pending chan *goblinpb.GossipMessage
+}
+
+func newMessageBus(name string, maxSize int, logger *zap.Logger) *messageBus {
+	return &messageBus{
+		name:    name,
+		maxSize: maxSize,
+		logger:  logger,
+
+		handlers: map[string]MessageHandler{},
+		seen:     newSeenCache(messageDedupSize),
+
+		pending: make(chan *goblinpb.GossipMessage, messageDispatchSize),
+	}
+}
+
+func (b *messageBus) markSeen(id []byte) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.seen.add(string(id))
+}
+
+func (b *messageBus) setHandler(topic string, handler MessageHandler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if handler == nil {
+		delete(b.handlers, topic)
+		return
+	}
+	b.handlers[topic] = handler
+}
+
+func (b *messageBus) getHandler(topic string) MessageHandler {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.handlers[topic]
+}
+
+func (b *messageBus) broadcast(topic string, payload []byte) error {
+	id := uuid.New()
+	msg := &goblinpb.GossipMessage{
+		Id:      id[:],
+		Sender:  b.name,
+		Topic:   topic,
+		Payload: payload,
+	}
+
+	data, err := marshalAppMessage(msg)
+	if err != nil {
+		return err
+	}
+	if len(data) > b.maxSize {
+		return ErrMessageTooLarge
+	}
+
+	b.markSeen(msg.Id)
+	b.broadcasts.QueueBroadcast(appBroadcast{msg: data})
+	b.dispatch(msg)
+	return nil
+}
+
+// receive re-broadcasts a message only the first time it is seen, for reaching all nodes
+func (b *messageBus) receive(data []byte) {
+	msg, ok := unmarshalAppMessage(data)
+	if !ok {
+		return
+	}
+	if !b.markSeen(msg.Id) {
+		return
+	}
+
+	// data is owned by memberlist, copy it before queueing
+	b.broadcasts.QueueBroadcast(appBroadcast{msg: append([]byte(nil), data...)})
+	b.dispatch(msg)
+}
+
+// dispatch does not block memberlist, drops the message if handlers are too slow
+func (b *messageBus) dispatch(msg *goblinpb.GossipMessage) {
+	select {
+	case b.pending <- msg:
+	default:
+		b.logger.Warn("gossip message dropped, handlers are too slow", zap.String("topic", msg.Topic))
+	}
+}
+
+func (b *messageBus) run(ctx context.Context) {
+	for {
+		select {
+		case msg := <-b.pending:
+			handler := b.getHandler(msg.Topic)
+			if handler != nil {
+				handler(msg.Sender, msg.Payload)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Broadcast sends a small message to all members (including the current node) by gossiping,
+// the delivery is best-effort and unordered. Returns ErrMessageTooLarge if the message
+// does not fit in a gossip packet (about memberlist UDPBufferSize)
+func (s *PoolServer) Broadcast(topic string, payload []byte) error {
+	return s.messages.broadcast(topic, payload)
+}
+
+// OnMessage registers the handler for messages of a topic, replaces the previous one, nil for removing.
+// Handlers are called sequentially in a separate goroutine, messages are dropped when they are too slow
+func (s *PoolServer) OnMessage(topic string, handler MessageHandler) {
+	s.messages.setHandler(topic, handler)
+}
@@ -0,0 +1,156 @@
+package goblin
+
+import (
+	"bytes"
+	"context"
+	"github.com/QuangTung97/goblin/goblinpb"
+	"github.com/hashicorp/memberlist"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func newTestMessageBus(maxSize int) *messageBus {
+	b := newMessageBus("node-1", maxSize, zap.NewNop())
+	b.broadcasts = &memberlist.TransmitLimitedQueue{
+		RetransmitMult: 4,
+		NumNodes:       func() int { return 3 },
+	}
+	return b
+}
+
+type receivedMessage struct {
+	from    string
+	payload string
+}
+
+func TestMarshalUnmarshalAppMessage(t *testing.T) {
+	msg := &goblinpb.GossipMessage{
+		Id:      []byte("id-1"),
+		Sender:  "node-1",
+		Topic:   "topic-1",
+		Payload: []byte("name@address"),
+	}
+
+	data, err := marshalAppMessage(msg)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, isAppMessage(data))
+	assert.Equal(t, false, bytes.Contains(data, []byte("@")))
+
+	// older nodes ignore it
+	_, ok := unmarshalBroadcast(data)
+	assert.Equal(t, false, ok)
+
+	result, ok := unmarshalAppMessage(data)
+	assert.Equal(t, true, ok)
+	assert.Equal(t, true, proto.Equal(msg, result))
+
+	_, ok = unmarshalAppMessage(marshalBroadcast(broadcast{name: "name-1", addr: "address-1"}))
+	assert.Equal(t, false, ok)
+
+	_, ok = unmarshalAppMessage([]byte{appMessagePrefix, '#'})
+	assert.Equal(t, false, ok)
+}
+
+func TestSeenCache(t *testing.T) {
+	c := newSeenCache(2)
+	assert.Equal(t, true, c.add("id-1"))
+	assert.Equal(t, false, c.add("id-1"))
+	assert.Equal(t, true, c.add("id-2"))
+	assert.Equal(t, true, c.add("id-3"))
+
+	// id-1 is evicted
+	assert.Equal(t, 2, len(c.ids))
+	assert.Equal(t, false, c.add("id-3"))
+	assert.Equal(t, true, c.add("id-1"))
+	assert.Equal(t, true, c.add("id-4"))
+	assert.Equal(t, false, c.add("id-1"))
+}
+
+func TestMessageBus_Receive_Dedup(t *testing.T) {
+	b := newTestMessageBus(1000)
+
+	data, err := marshalAppMessage(&goblinpb.GossipMessage{
+		Id:      []byte("id-1"),
+		Sender:  "node-2",
+		Topic:   "topic-1",
+		Payload: []byte("payload-1"),
+	})
+	assert.Equal(t, nil, err)
+
+	b.receive(data)
+	b.receive(data)
+	b.receive([]byte{appMessagePrefix})
+
+	assert.Equal(t, 1, b.broadcasts.NumQueued())
+	assert.Equal(t, 1, len(b.pending))
+
+	msg := <-b.pending
+	assert.Equal(t, "node-2", msg.Sender)
+	assert.Equal(t, "payload-1", string(msg.Payload))
+}
+
+func TestMessageBus_Broadcast(t *testing.T) {
+	b := newTestMessageBus(1000)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	received := make(chan receivedMessage, 10)
+	b.setHandler("topic-1", func(from string, payload []byte) {
+		received <- receivedMessage{from: from, payload: string(payload)}
+	})
+	go b.run(ctx)
+
+	err := b.broadcast("topic-1", []byte("payload-1"))
+	assert.Equal(t, nil, err)
+	err = b.broadcast("topic-2", []byte("payload-2"))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, b.broadcasts.NumQueued())
+
+	select {
+	case msg := <-received:
+		assert.Equal(t, receivedMessage{from: "node-1", payload: "payload-1"}, msg)
+	case <-time.After(time.Second):
+		t.Fatal("message not received")
+	}
+
+	// own messages gossiped back are ignored
+	queued := b.broadcasts.GetBroadcasts(0, 10000)
+	for _, data := range queued {
+		b.receive(data)
+	}
+	assert.Equal(t, 0, len(b.pending))
+}
+
+func TestMessageBus_Broadcast_Too_Large(t *testing.T) {
+	b := newTestMessageBus(100)
+	err := b.broadcast("topic-1", bytes.Repeat([]byte("a"), 100))
+	assert.Equal(t, ErrMessageTooLarge, err)
+	assert.Equal(t, 0, b.broadcasts.NumQueued())
+}
+
+func TestMessageBus_Dispatch_Drop_When_Full(t *testing.T) {
+	b := newTestMessageBus(1000)
+	for i := 0; i < messageDispatchSize+10; i++ {
+		err := b.broadcast("topic-1", []byte(strconv.Itoa(i)))
+		assert.Equal(t, nil, err)
+	}
+	assert.Equal(t, messageDispatchSize, len(b.pending))
+}
+
+func TestDelegate_NotifyMsg_App_Message(t *testing.T) {
+	nodes := newNodeMap(30 * time.Second)
+	d := newDelegate(nodes)
+	d.messages = newTestMessageBus(1000)
+	d.broadcasts = d.messages.broadcasts
+
+	data, err := marshalAppMessage(&goblinpb.GossipMessage{Id: []byte("id-1"), Topic: "topic-1"})
+	assert.Equal(t, nil, err)
+
+	d.NotifyMsg(data)
+	assert.Equal(t, 1, len(d.messages.pending))
+	assert.Equal(t, map[string]leftNode{}, nodes.getLeftNodes())
+}
@@ -0,0 +1,41 @@
+package goblin
+
+import "time"
+
+// ClientMetrics receives events from PoolClient for monitoring,
+// embed NopClientMetrics to implement only a subset of methods
+type ClientMetrics interface {
+	// MembershipStaleness is called periodically with the result of PoolClient.Staleness()
+	MembershipStaleness(d time.Duration)
+
+	// StaleProbe is called after probing a node while the membership view is stale
+	StaleProbe(nodeName string, err error)
+
+	// StaleDrop is called when a node is removed because the membership view is stale
+	StaleDrop(nodeName string)
+
+	// NodeConnError is called when creating a connection for a node fails
+	NodeConnError(nodeName string, err error)
+}
+
+// NopClientMetrics is a ClientMetrics that does nothing
+type NopClientMetrics struct {
+}
+
+var _ ClientMetrics = NopClientMetrics{}
+
+// MembershipStaleness does nothing
+func (NopClientMetrics) MembershipStaleness(time.Duration) {
+}
+
+// StaleProbe does nothing
+func (NopClientMetrics) StaleProbe(string, error) {
+}
+
+// StaleDrop does nothing
+func (NopClientMetrics) StaleDrop(string) {
+}
+
+// NodeConnError does nothing
+func (NopClientMetrics) NodeConnError(string, error) {
+}
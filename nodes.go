@@ -8,23 +8,26 @@ import (
 
 // Node ...
 type Node struct {
-	Addr string
+	Addr     string
+	Load     float64 // the load reported by the node through PoolServer.SetLoad, lower is less loaded
+	GRPCAddr string  // the advertised gRPC address, empty for nodes of older versions
+	Instance string  // changes on every start of the node, empty for nodes of older versions
 }
 
 type leftNode struct {
 	addr       string
 	lastUpdate time.Time
+	instance   string // empty if unknown
 }
 
 type nodeMap struct {
+	mu           sync.Mutex
+	cond         *sync.Cond
+	nodes        map[string]Node
+	leftNodes    map[string]leftNode
 	leftNodeTime time.Duration
-
-	mu        sync.Mutex
-	cond      *sync.Cond
-	nodes     map[string]Node
-	leftNodes map[string]leftNode
-	seq       uint64
-	getNow    func() time.Time
+	seq          uint64
+	getNow       func() time.Time
 }
 
 func newNodeMap(leftNodeTime time.Duration) *nodeMap {
@@ -40,8 +43,14 @@ func newNodeMap(leftNodeTime time.Duration) *nodeMap {
 }
 
 func (n *nodeMap) nodeJoin(name string, addr string) {
-	n.nodeJoinLock(name, addr)
-	n.cond.Broadcast()
+	n.nodeUpsert(name, Node{Addr: addr})
+}
+
+// nodeUpsert adds the node or replaces its info, watchers are only notified if the info changed
+func (n *nodeMap) nodeUpsert(name string, node Node) {
+	if n.nodeUpsertLock(name, node) {
+		n.cond.Broadcast()
+	}
 }
 
 // leave because of Dead of Left
@@ -51,6 +60,12 @@ func (n *nodeMap) nodeLeave(name string) {
 }
 
 func (n *nodeMap) nodeGracefulLeave(name string, addr string) bool {
+	return n.nodeGracefulLeaveInstance(name, addr, "")
+}
+
+// nodeGracefulLeaveInstance an empty instance refers to the instance currently known.
+// Returns false if already left or the leave is of a previous instance of a restarted node
+func (n *nodeMap) nodeGracefulLeaveInstance(name string, addr string, instance string) bool {
 	n.mu.Lock()
 	defer n.mu.Unlock()
 
@@ -58,22 +73,42 @@ func (n *nodeMap) nodeGracefulLeave(name string, addr string) bool {
 	if existed {
 		return false
 	}
+
+	current, alive := n.nodes[name]
+	if instance == "" {
+		instance = current.Instance
+	}
+	if alive && current.Instance != "" && current.Instance != instance {
+		return false
+	}
+
 	n.leftNodes[name] = leftNode{
 		addr:       addr,
 		lastUpdate: n.getNow(),
+		instance:   instance,
 	}
 	return true
 }
 
-func (n *nodeMap) nodeJoinLock(name string, addr string) {
+func (n *nodeMap) nodeUpsertLock(name string, node Node) bool {
 	n.mu.Lock()
 	defer n.mu.Unlock()
 
-	n.nodes = cloneNodeMap(n.nodes)
-	n.nodes[name] = Node{
-		Addr: addr,
+	// a restarted node with the same name is no longer left
+	left, isLeft := n.leftNodes[name]
+	if isLeft && node.Instance != "" && left.instance != node.Instance {
+		delete(n.leftNodes, name)
 	}
+
+	old, existed := n.nodes[name]
+	if existed && old == node {
+		return false
+	}
+
+	n.nodes = cloneNodeMap(n.nodes)
+	n.nodes[name] = node
 	n.seq++
+	return true
 }
 
 func (n *nodeMap) nodeLeaveLock(name string) {
@@ -86,6 +121,11 @@ func (n *nodeMap) nodeLeaveLock(name string) {
 }
 
 func (n *nodeMap) watcherShouldLeave() {
+	n.wakeWatchers()
+}
+
+// wakeWatchers makes watchNodes return without changing the nodes
+func (n *nodeMap) wakeWatchers() {
 	n.mu.Lock()
 	n.seq++
 	n.mu.Unlock()
@@ -93,6 +133,12 @@ func (n *nodeMap) watcherShouldLeave() {
 	n.cond.Broadcast()
 }
 
+func (n *nodeMap) setLeftNodeTime(d time.Duration) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.leftNodeTime = d
+}
+
 func (n *nodeMap) getNotJoinedAddresses(addrs []string) (uint64, []string) {
 	n.mu.Lock()
 	defer n.mu.Unlock()
@@ -239,3 +239,71 @@ func TestNodeMapSame(t *testing.T) {
 		assert.Equal(t, false, nodeMapSame(a, b))
 	})
 }
+
+func TestNodes_Upsert_Only_Changed(t *testing.T) {
+	n := newNodeMap(30 * time.Second)
+	n.nodeUpsert("name-1", Node{Addr: "address-1", Load: 1})
+	n.nodeUpsert("name-1", Node{Addr: "address-1", Load: 1})
+
+	seq, nodes := n.getNodes()
+	assert.Equal(t, uint64(1), seq)
+
+	n.nodeUpsert("name-1", Node{Addr: "address-1", Load: 2})
+	seq, newNodes := n.getNodes()
+	assert.Equal(t, uint64(2), seq)
+	assert.Equal(t, map[string]Node{"name-1": {Addr: "address-1", Load: 1}}, nodes)
+	assert.Equal(t, map[string]Node{"name-1": {Addr: "address-1", Load: 2}}, newNodes)
+}
+
+func TestNodes_Restart_Same_Name(t *testing.T) {
+	n := newNodeMap(30 * time.Second)
+	now := mustParse("2021-06-18T09:00:00+07:00")
+	n.getNow = func() time.Time { return now }
+
+	n.nodeUpsert("name-1", Node{Addr: "address-1", Instance: "instance-1"})
+	n.nodeUpsert("name-2", Node{Addr: "address-2", Instance: "instance-2"})
+
+	// the instance is taken from the current one
+	assert.Equal(t, true, n.nodeGracefulLeave("name-1", "address-1"))
+	assert.Equal(t, map[string]leftNode{
+		"name-1": {addr: "address-1", lastUpdate: now, instance: "instance-1"},
+	}, n.leftNodes)
+
+	// metadata updates of the leaving instance do not clear it
+	n.nodeUpsert("name-1", Node{Addr: "address-1", Load: 2, Instance: "instance-1"})
+	assert.Equal(t, 1, len(n.leftNodes))
+
+	n.nodeLeave("name-1")
+
+	// restarted with a new instance
+	n.nodeUpsert("name-1", Node{Addr: "address-5", Instance: "instance-3"})
+	assert.Equal(t, map[string]leftNode{}, n.leftNodes)
+
+	// leaves of the previous instance from other members are ignored
+	assert.Equal(t, false, n.nodeGracefulLeaveInstance("name-1", "address-1", "instance-1"))
+	assert.Equal(t, map[string]leftNode{}, n.leftNodes)
+
+	_, result := n.getNotJoinedAddresses([]string{"address-5"})
+	assert.Equal(t, []string(nil), result)
+
+	assert.Equal(t, true, n.nodeGracefulLeaveInstance("name-1", "address-5", "instance-3"))
+	assert.Equal(t, false, n.nodeGracefulLeave("name-1", "address-5"))
+	assert.Equal(t, map[string]leftNode{
+		"name-1": {addr: "address-5", lastUpdate: now, instance: "instance-3"},
+	}, n.leftNodes)
+}
+
+func TestNodes_Restart_Older_Version_Node(t *testing.T) {
+	n := newNodeMap(30 * time.Second)
+	n.nodeJoin("name-1", "address-1")
+
+	assert.Equal(t, true, n.nodeGracefulLeave("name-1", "address-1"))
+	assert.Equal(t, true, n.nodeGracefulLeave("name-2", "address-2"))
+
+	// no instance, can not know whether it is restarted
+	n.nodeJoin("name-1", "address-1")
+	assert.Equal(t, 2, len(n.leftNodes))
+
+	n.nodeUpsert("name-2", Node{Addr: "address-2", Instance: "instance-2"})
+	assert.Equal(t, 1, len(n.leftNodes))
+}
@@ -12,6 +12,21 @@ type serverOptions struct {
 	joinRetryTime      time.Duration
 	logger             *zap.Logger
 	memberlistConf     func(conf *memberlist.Config)
+	watchAuthorizer    WatchAuthorizer
+	watchBufferSize    int
+	loadReportInterval time.Duration
+	loadFunc           func() float64
+	loadThreshold      float64
+	kvTombstoneTTL     time.Duration
+
+	leaderStabilityDelay time.Duration
+	expectedMembers      int
+
+	shardCount      int
+	shardLoadFactor float64
+
+	configFile         string
+	configPollInterval time.Duration
 }
 
 func defaultServerOptions() serverOptions {
@@ -21,6 +36,17 @@ func defaultServerOptions() serverOptions {
 		joinRetryTime:      30 * time.Second,
 		logger:             zap.NewNop(),
 		memberlistConf:     func(conf *memberlist.Config) {},
+		watchAuthorizer:    allowAllAuthorizer,
+		watchBufferSize:    8,
+		loadReportInterval: 5 * time.Second,
+		loadThreshold:      0.1,
+		kvTombstoneTTL:     time.Hour,
+
+		leaderStabilityDelay: 10 * time.Second,
+
+		shardLoadFactor: 1.25,
+
+		configPollInterval: 10 * time.Second,
 	}
 }
 
@@ -49,7 +75,8 @@ func WithServerMemberlistConfig(fn func(config *memberlist.Config)) ServerOption
 	}
 }
 
-// WithServerPortDiff configures the port difference between gRPC and memberlist ports
+// WithServerPortDiff configures the port difference between gRPC and memberlist ports,
+// used for the default memberlist port and for converting ServerConfig.StaticAddrs
 func WithServerPortDiff(diff uint16) ServerOption {
 	return func(opts *serverOptions) {
 		opts.portDiff = diff
@@ -63,19 +90,148 @@ func WithJoinRetryDuration(d time.Duration) ServerOption {
 	}
 }
 
+// WithWatchAuthorizer configures the authorizer for Watch and GetNode RPCs (default allows all),
+// nil allows all
+func WithWatchAuthorizer(authorizer WatchAuthorizer) ServerOption {
+	return func(opts *serverOptions) {
+		if authorizer == nil {
+			authorizer = allowAllAuthorizer
+		}
+		opts.watchAuthorizer = authorizer
+	}
+}
+
+// WithWatchBufferSize configures the number of snapshots buffered for each Watch stream,
+// when the buffer is full, the slow stream skips to the latest snapshot
+func WithWatchBufferSize(size int) ServerOption {
+	return func(opts *serverOptions) {
+		opts.watchBufferSize = size
+	}
+}
+
+// WithLoadReportInterval configures how often the load score is published to the cluster (default 5s),
+// zero disables load reporting
+func WithLoadReportInterval(d time.Duration) ServerOption {
+	return func(opts *serverOptions) {
+		opts.loadReportInterval = d
+	}
+}
+
+// WithLoadFunc configures a function to compute the load score before each report,
+// e.g. InFlightCounter.Load, replaces the value set by PoolServer.SetLoad.
+// No CPU based load is provided, a CPU usage signal can be supplied through this function
+func WithLoadFunc(fn func() float64) ServerOption {
+	return func(opts *serverOptions) {
+		opts.loadFunc = fn
+	}
+}
+
+// WithLoadReportThreshold configures the minimum change of the load score to publish it (default 0.1),
+// relative to the last published score, or absolute for scores below 1. Each publish updates the memberlist
+// metadata, which is gossiped to all members and sends a new node list to every watching client,
+// so small fluctuations are not published. Zero publishes every change
+func WithLoadReportThreshold(threshold float64) ServerOption {
+	return func(opts *serverOptions) {
+		opts.loadThreshold = threshold
+	}
+}
+
+// WithKVTombstoneTTL configures how long deleted keys of the replicated key/value store are remembered
+// (default 1 hour), it should be longer than the time for an update to reach all members
+func WithKVTombstoneTTL(d time.Duration) ServerOption {
+	return func(opts *serverOptions) {
+		opts.kvTombstoneTTL = d
+	}
+}
+
+// WithLeaderStabilityDelay configures how long a member must be seen before it can become the leader (default 10s)
+func WithLeaderStabilityDelay(d time.Duration) ServerOption {
+	return func(opts *serverOptions) {
+		opts.leaderStabilityDelay = d
+	}
+}
+
+// WithExpectedMembers configures the expected cluster size for PartitionSuspected,
+// default uses the maximum number of members seen
+func WithExpectedMembers(n int) ServerOption {
+	return func(opts *serverOptions) {
+		opts.expectedMembers = n
+	}
+}
+
+// WithShardCount enables assigning shards [0, n) to members (default disabled)
+func WithShardCount(n int) ServerOption {
+	return func(opts *serverOptions) {
+		opts.shardCount = n
+	}
+}
+
+// WithShardLoadFactor configures the bound of shards per member (default 1.25): a member owns at most
+// ceil(loadFactor * shardCount / members) shards. Higher factors move fewer shards on membership changes
+func WithShardLoadFactor(factor float64) ServerOption {
+	return func(opts *serverOptions) {
+		opts.shardLoadFactor = factor
+	}
+}
+
+// WithConfigFile reloads seeds and tunables from a JSON file whenever its content changes, polled every
+// pollInterval (default 10s). Format: {"seeds": ["host:port"], "memberlist_seeds": ["host:port"],
+// "join_retry": "30s", "left_node_expire": "30s"}, where seeds are gRPC addresses (see ServerConfig.StaticAddrs)
+// and memberlist_seeds are memberlist addresses (see ServerConfig.StaticMemberlistAddrs).
+// Absent fields are not changed, seeds are ignored when IsDynamicIPs is true
+func WithConfigFile(path string, pollInterval time.Duration) ServerOption {
+	return func(opts *serverOptions) {
+		opts.configFile = path
+		if pollInterval > 0 {
+			opts.configPollInterval = pollInterval
+		}
+	}
+}
+
 //================================================================
 
 type clientOptions struct {
-	portDiff   uint16
-	watchRetry time.Duration
-	logger     *zap.Logger
+	portDiff      uint16
+	watchRetryMin time.Duration
+	watchRetry    time.Duration
+	watchSources  int
+	logger        *zap.Logger
+
+	memberCacheFile string
+
+	stalenessTTL time.Duration
+	stalePolicy  StalePolicy
+	metrics      ClientMetrics
+
+	connsPerNode   int
+	lazyConnect    bool
+	quarantineTime time.Duration
+	drainTimeout   time.Duration
+	closeTimeout   time.Duration
+	loadAware      bool
+	shardRouting   bool
+
+	hedgePercentile  float64
+	concurrencyLimit ConcurrencyLimit
+	circuitBreaker   CircuitBreaker
 }
 
 func defaultClientOptions() clientOptions {
 	return clientOptions{
-		portDiff:   2000,
-		watchRetry: 60 * time.Second,
-		logger:     zap.NewNop(),
+		portDiff:      2000,
+		watchRetryMin: 200 * time.Millisecond,
+		watchRetry:    60 * time.Second,
+		watchSources:  1,
+		logger:        zap.NewNop(),
+
+		stalePolicy: StalePolicyKeep,
+		metrics:     NopClientMetrics{},
+
+		connsPerNode:   1,
+		quarantineTime: 30 * time.Second,
+		closeTimeout:   10 * time.Second,
+
+		hedgePercentile: 0.95,
 	}
 }
 
@@ -97,16 +253,150 @@ func WithClientLogger(logger *zap.Logger) ClientOption {
 	}
 }
 
-// WithWatchRetryDuration configures watch nodes retry duration
+// WithWatchRetryDuration configures the maximum retry duration of watching nodes
 func WithWatchRetryDuration(d time.Duration) ClientOption {
 	return func(opts *clientOptions) {
 		opts.watchRetry = d
 	}
 }
 
-// WithClientPortDiff configures the port difference between gRPC and memberlist ports
+// WithWatchBackoff configures the exponential backoff (with jitter) of watching nodes,
+// retrying starts from min and doubles up to max
+func WithWatchBackoff(min, max time.Duration) ClientOption {
+	return func(opts *clientOptions) {
+		opts.watchRetryMin = min
+		opts.watchRetry = max
+	}
+}
+
+// WithMemberCacheFile configures a file to persist the last known member addresses,
+// they are used for connecting Watch streams after restarting
+func WithMemberCacheFile(path string) ClientOption {
+	return func(opts *clientOptions) {
+		opts.memberCacheFile = path
+	}
+}
+
+// WithWatchSources configures the number of Watch streams to different nodes at the same time (default 1),
+// updates are applied from only one stream, the others are standbys for fast failover
+func WithWatchSources(n int) ClientOption {
+	return func(opts *clientOptions) {
+		opts.watchSources = n
+	}
+}
+
+// WithClientPortDiff configures the port difference between gRPC and memberlist ports,
+// only used for nodes of older versions that do not advertise their gRPC addresses
 func WithClientPortDiff(diff uint16) ClientOption {
 	return func(opts *clientOptions) {
 		opts.portDiff = diff
 	}
 }
+
+// WithStalenessTTL enables checking the staleness of the membership view (default disabled),
+// the stale policy is applied when no Watch stream is connected for longer than ttl.
+// A ttl below minStalenessTTL (10ms) is raised to it
+func WithStalenessTTL(ttl time.Duration) ClientOption {
+	return func(opts *clientOptions) {
+		if ttl > 0 && ttl < minStalenessTTL {
+			ttl = minStalenessTTL
+		}
+		opts.stalenessTTL = ttl
+	}
+}
+
+// WithStalePolicy configures the action when the membership view is stale (default StalePolicyKeep)
+func WithStalePolicy(policy StalePolicy) ClientOption {
+	return func(opts *clientOptions) {
+		opts.stalePolicy = policy
+	}
+}
+
+// WithClientMetrics configures the metrics of PoolClient
+func WithClientMetrics(metrics ClientMetrics) ClientOption {
+	return func(opts *clientOptions) {
+		opts.metrics = metrics
+	}
+}
+
+// WithLazyConnect creates connections to nodes on first use instead of on receiving membership
+func WithLazyConnect() ClientOption {
+	return func(opts *clientOptions) {
+		opts.lazyConnect = true
+	}
+}
+
+// WithNodeQuarantineDuration configures the duration that a node is skipped after failing to create its connection,
+// the connection is retried when the duration is over (at least 10ms). Zero disables the quarantine, failed nodes
+// are retried on the next membership change. Nodes with invalid addresses are only retried when their addresses change
+func WithNodeQuarantineDuration(d time.Duration) ClientOption {
+	return func(opts *clientOptions) {
+		if d > 0 && d < minQuarantineTime {
+			d = minQuarantineTime
+		}
+		opts.quarantineTime = d
+	}
+}
+
+// WithDrainTimeout configures the grace period for in-flight requests and streams after a node is removed,
+// after that the connection is force-closed (default zero, waits for all requests to finish)
+func WithDrainTimeout(d time.Duration) ClientOption {
+	return func(opts *clientOptions) {
+		opts.drainTimeout = d
+	}
+}
+
+// WithConnsPerNode configures the number of connections to each node (default 1),
+// requests are balanced across all of them
+func WithConnsPerNode(n int) ClientOption {
+	return func(opts *clientOptions) {
+		opts.connsPerNode = n
+	}
+}
+
+// WithCloseTimeout configures the maximum duration that Close waits for in-flight requests (default 10s)
+func WithCloseTimeout(d time.Duration) ClientOption {
+	return func(opts *clientOptions) {
+		opts.closeTimeout = d
+	}
+}
+
+// WithLoadAwareBalancing biases the selection toward less-loaded nodes using the load
+// reported by PoolServer.SetLoad, each request picks the less loaded of two candidate connections
+func WithLoadAwareBalancing() ClientOption {
+	return func(opts *clientOptions) {
+		opts.loadAware = true
+	}
+}
+
+// WithShardRouting watches the shard map from the pool servers (see WithShardCount) for GetConnForKey
+func WithShardRouting() ClientOption {
+	return func(opts *clientOptions) {
+		opts.shardRouting = true
+	}
+}
+
+// WithHedgePercentile configures the percentile of recent latencies used as the hedge delay
+// of GetConnHedged when hedgeDelay is not positive (default 0.95)
+func WithHedgePercentile(p float64) ClientOption {
+	return func(opts *clientOptions) {
+		opts.hedgePercentile = p
+	}
+}
+
+// WithConcurrencyLimit enables client-side limits of in-flight requests and leases,
+// calls fail fast with ErrOverloaded when all nodes are saturated. Leases and streams (including
+// the shard map watch of WithShardRouting) count toward the limits for their whole lifetime
+func WithConcurrencyLimit(conf ConcurrencyLimit) ClientOption {
+	return func(opts *clientOptions) {
+		opts.concurrencyLimit = conf.withDefaults()
+	}
+}
+
+// WithCircuitBreaker enables per-node circuit breakers, nodes with open circuits are skipped
+// (see CircuitBreaker and PoolClient.GetBreakerState)
+func WithCircuitBreaker(conf CircuitBreaker) ClientOption {
+	return func(opts *clientOptions) {
+		opts.circuitBreaker = conf.withDefaults()
+	}
+}
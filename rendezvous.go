@@ -0,0 +1,95 @@
+package goblin
+
+import (
+	"sort"
+)
+
+// rendezvousWeight is the highest-random-weight of a node for a key
+func rendezvousWeight(nodeName string, key string) uint64 {
+	data := make([]byte, 0, len(nodeName)+1+len(key))
+	data = append(data, nodeName...)
+	data = append(data, 0)
+	data = append(data, key...)
+	return hash64(data)
+}
+
+// rendezvousNodes returns up to replicas distinct node names ordered by decreasing weight for key
+func rendezvousNodes(conns *clientConns, key string, replicas int) []string {
+	if conns == nil || replicas <= 0 {
+		return nil
+	}
+
+	type weightedNode struct {
+		name   string
+		weight uint64
+	}
+
+	existed := map[string]struct{}{}
+	nodes := make([]weightedNode, 0, len(conns.conns))
+	for _, conn := range conns.conns {
+		if _, ok := existed[conn.nodeName]; ok {
+			continue
+		}
+		existed[conn.nodeName] = struct{}{}
+		nodes = append(nodes, weightedNode{
+			name:   conn.nodeName,
+			weight: rendezvousWeight(conn.nodeName, key),
+		})
+	}
+
+	sort.Slice(nodes, func(i, j int) bool {
+		if nodes[i].weight != nodes[j].weight {
+			return nodes[i].weight > nodes[j].weight
+		}
+		return nodes[i].name < nodes[j].name
+	})
+
+	if len(nodes) > replicas {
+		nodes = nodes[:replicas]
+	}
+	result := make([]string, 0, len(nodes))
+	for _, n := range nodes {
+		result = append(result, n.name)
+	}
+	return result
+}
+
+// GetConnsForKey returns leases of up to replicas distinct nodes for key, ordered by rendezvous
+// (highest-random-weight) hashing of node names. Adding or removing a node only changes the replica sets
+// containing it. Fewer leases are returned when the pool has fewer nodes. Nodes that can not be acquired
+// (e.g. failing to connect or with open circuit breakers) are skipped, so the first lease is not always
+// the primary: Lease.Rank returns the rank of each node, rank zero is the primary.
+// Returns an error only if no lease can be acquired. Release must be called on all returned leases
+func (c *PoolClient) GetConnsForKey(key string, replicas int) ([]*Lease, error) {
+	if c.isClosed() {
+		return nil, ErrClosed
+	}
+
+	names := rendezvousNodes(c.getClientConns(), key, replicas)
+
+	var lastErr error
+	result := make([]*Lease, 0, len(names))
+	for rank, name := range names {
+		conn, err := c.acquireConnByName(name)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		lease, err := c.newLease(conn)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		lease.rank = rank
+		result = append(result, lease)
+	}
+
+	if len(result) > 0 {
+		return result, nil
+	}
+	if lastErr != nil {
+		return nil, lastErr
+	}
+	return nil, ErrNoConn
+}
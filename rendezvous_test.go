@@ -0,0 +1,110 @@
+package goblin
+
+import (
+	"github.com/QuangTung97/goblin/goblinpb"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func newTestRendezvousConns(names ...string) *clientConns {
+	result := &clientConns{}
+	for _, name := range names {
+		result.conns = append(result.conns, &clientConn{nodeName: name, refCount: 1})
+	}
+	return result
+}
+
+func TestRendezvousNodes(t *testing.T) {
+	conns := newTestRendezvousConns("name-1", "name-2", "name-3", "name-2")
+
+	assert.Equal(t, []string(nil), rendezvousNodes(nil, "key-1", 2))
+	assert.Equal(t, []string(nil), rendezvousNodes(conns, "key-1", 0))
+
+	all := rendezvousNodes(conns, "key-1", 5)
+	assert.Equal(t, 3, len(all))
+	assert.ElementsMatch(t, []string{"name-1", "name-2", "name-3"}, all)
+
+	// prefix of the full order, not depending on the order of connections
+	assert.Equal(t, all[:2], rendezvousNodes(conns, "key-1", 2))
+	assert.Equal(t, all, rendezvousNodes(newTestRendezvousConns("name-3", "name-2", "name-1"), "key-1", 3))
+}
+
+func TestRendezvousNodes_Minimal_Disruption(t *testing.T) {
+	before := newTestRendezvousConns("name-1", "name-2", "name-3", "name-4")
+	after := newTestRendezvousConns("name-1", "name-2", "name-3")
+
+	primaries := map[string]int{}
+	for i := 0; i < 400; i++ {
+		key := "key-" + strconv.Itoa(i)
+		old := rendezvousNodes(before, key, 2)
+		primaries[old[0]]++
+
+		// keys not served by the removed node keep their replica sets
+		if old[0] != "name-4" && old[1] != "name-4" {
+			assert.Equal(t, old, rendezvousNodes(after, key, 2))
+		}
+	}
+
+	for _, count := range primaries {
+		assert.Greater(t, count, 50)
+	}
+}
+
+func TestPoolClient_GetConnsForKey(t *testing.T) {
+	pool := makePoolClient(ClientConfig{})
+	_, err := pool.GetConnsForKey("key-1", 2)
+	assert.Equal(t, ErrNoConn, err)
+
+	factory := newTestConnFactory(func(addr string) (*grpc.ClientConn, error) {
+		return grpc.Dial(addr, grpc.WithInsecure())
+	})
+	factory.lazyConnect = true
+	conns, _ := computeNewClientConns(nil, []*goblinpb.Node{
+		{Name: "name-1", Addr: "127.0.0.1:5801"},
+		{Name: "name-2", Addr: "127.0.0.1:5802"},
+		{Name: "name-3", Addr: "127.0.0.1:5803"},
+	}, factory)
+	pool.setClientConns(conns)
+
+	leases, err := pool.GetConnsForKey("key-1", 2)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, len(leases))
+
+	expected := rendezvousNodes(conns, "key-1", 2)
+	assert.Equal(t, expected, []string{leases[0].NodeName(), leases[1].NodeName()})
+	assert.Equal(t, []int{0, 1}, []int{leases[0].Rank(), leases[1].Rank()})
+	for _, lease := range leases {
+		assert.Equal(t, uint64(2), lease.conn.refCount)
+		lease.Release()
+		assert.Equal(t, uint64(1), lease.conn.refCount)
+	}
+
+	leases, err = pool.GetConnsForKey("key-1", 5)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 3, len(leases))
+	for _, lease := range leases {
+		lease.Release()
+	}
+
+	// the primary is skipped
+	breaker := newCircuitBreaker(CircuitBreaker{FailureThreshold: 1}.withDefaults())
+	breaker.onResult(time.Now(), true)
+	for _, conn := range conns.conns {
+		if conn.nodeName == expected[0] {
+			conn.state.breaker = breaker
+		}
+	}
+	leases, err = pool.GetConnsForKey("key-1", 2)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(leases))
+	assert.Equal(t, expected[1], leases[0].NodeName())
+	assert.Equal(t, 1, leases[0].Rank())
+	leases[0].Release()
+
+	_ = pool.Close()
+	_, err = pool.GetConnsForKey("key-1", 2)
+	assert.Equal(t, ErrClosed, err)
+}
@@ -0,0 +1,249 @@
+package goblin
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+// ErrSeedsNotUsed when updating seeds of a server with IsDynamicIPs
+var ErrSeedsNotUsed = errors.New("seeds are not used when IsDynamicIPs is true")
+
+// seedLists are the static seeds, given by gRPC addresses or by memberlist addresses
+type seedLists struct {
+	grpcAddrs       []string
+	memberlistAddrs []string
+}
+
+// computeStaticJoinAddrs converts gRPC addresses to memberlist addresses
+func computeStaticJoinAddrs(addrs []string, portDiff uint16) ([]string, error) {
+	joinAddrs := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		ip, port, err := getStaticIPAndPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		joinAddrs = append(joinAddrs, net.JoinHostPort(ip, strconv.Itoa(int(port+portDiff))))
+	}
+	return joinAddrs, nil
+}
+
+// computeJoinAddrs only gRPC addresses are converted, using the port difference
+func computeJoinAddrs(seeds seedLists, portDiff uint16) ([]string, error) {
+	joinAddrs, err := computeStaticJoinAddrs(seeds.grpcAddrs, portDiff)
+	if err != nil {
+		return nil, err
+	}
+	for _, addr := range seeds.memberlistAddrs {
+		_, _, err := getStaticIPAndPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		joinAddrs = append(joinAddrs, addr)
+	}
+	return joinAddrs, nil
+}
+
+// initSeeds returns the seeds of the config, and their memberlist addresses when IsDynamicIPs is false
+func initSeeds(config ServerConfig, portDiff uint16) (seedLists, []string, error) {
+	seeds := seedLists{
+		grpcAddrs:       config.StaticAddrs,
+		memberlistAddrs: config.StaticMemberlistAddrs,
+	}
+	if config.IsDynamicIPs {
+		return seeds, nil, nil
+	}
+
+	joinAddrs, err := computeJoinAddrs(seeds, portDiff)
+	if err != nil {
+		return seedLists{}, nil, err
+	}
+	return seeds, joinAddrs, nil
+}
+
+func (s *PoolServer) getSeeds() []string {
+	return *(*[]string)(atomic.LoadPointer(&s.seeds))
+}
+
+func (s *PoolServer) setSeeds(joinAddrs []string) {
+	atomic.StorePointer(&s.seeds, unsafe.Pointer(&joinAddrs))
+}
+
+func (s *PoolServer) seedsChangedChan() <-chan struct{} {
+	s.seedsMu.Lock()
+	defer s.seedsMu.Unlock()
+	return s.seedsChanged
+}
+
+// updateSeedLists validates the lists modified by fn before applying them, then wakes the join loop up
+// to join the new seeds without waiting for the join retry
+func (s *PoolServer) updateSeedLists(fn func(seeds *seedLists)) error {
+	if s.config.IsDynamicIPs {
+		return ErrSeedsNotUsed
+	}
+
+	s.seedsMu.Lock()
+	seeds := s.seedLists
+	fn(&seeds)
+
+	joinAddrs, err := computeJoinAddrs(seeds, s.options.portDiff)
+	if err != nil {
+		s.seedsMu.Unlock()
+		return err
+	}
+
+	s.seedLists = seeds
+	s.setSeeds(joinAddrs)
+	close(s.seedsChanged)
+	s.seedsChanged = make(chan struct{})
+	s.seedsMu.Unlock()
+
+	s.nodeMap.wakeWatchers()
+	return nil
+}
+
+// UpdateSeeds replaces ServerConfig.StaticAddrs (gRPC addresses), the new seeds that are not members
+// are joined immediately. Returns ErrSeedsNotUsed when IsDynamicIPs is true
+func (s *PoolServer) UpdateSeeds(addrs []string) error {
+	return s.updateSeedLists(func(seeds *seedLists) {
+		seeds.grpcAddrs = addrs
+	})
+}
+
+// UpdateMemberlistSeeds is like UpdateSeeds but replaces ServerConfig.StaticMemberlistAddrs
+func (s *PoolServer) UpdateMemberlistSeeds(addrs []string) error {
+	return s.updateSeedLists(func(seeds *seedLists) {
+		seeds.memberlistAddrs = addrs
+	})
+}
+
+// SetJoinRetryDuration replaces the value of WithJoinRetryDuration, applied after the current retry
+func (s *PoolServer) SetJoinRetryDuration(d time.Duration) {
+	atomic.StoreInt64(&s.joinRetry, int64(d))
+}
+
+func (s *PoolServer) getJoinRetryDuration() time.Duration {
+	return time.Duration(atomic.LoadInt64(&s.joinRetry))
+}
+
+// SetLeftNodeExpireTime configures how long gracefully left nodes are remembered (default 30s),
+// they are not joined again while remembered
+func (s *PoolServer) SetLeftNodeExpireTime(d time.Duration) {
+	s.nodeMap.setLeftNodeTime(d)
+}
+
+// sleepJoinRetry returns early when changed is closed or the server is shutdown
+func (s *PoolServer) sleepJoinRetry(changed <-chan struct{}) {
+	timer := time.NewTimer(s.getJoinRetryDuration())
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-changed:
+	case <-s.ctx.Done():
+	}
+}
+
+// serverConfigFile is the format of the file of WithConfigFile, absent fields are not changed
+type serverConfigFile struct {
+	Seeds           []string `json:"seeds"`
+	MemberlistSeeds []string `json:"memberlist_seeds"`
+	JoinRetry       string   `json:"join_retry"`       // e.g. "30s"
+	LeftNodeExpire  string   `json:"left_node_expire"` // e.g. "30s"
+}
+
+func parseOptionalDuration(s string) (time.Duration, bool, error) {
+	if s == "" {
+		return 0, false, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, false, err
+	}
+	if d <= 0 {
+		return 0, false, fmt.Errorf("duration must be positive: %s", s)
+	}
+	return d, true, nil
+}
+
+// applyConfigFile validates all fields before applying any of them
+func (s *PoolServer) applyConfigFile(data []byte) error {
+	var conf serverConfigFile
+	err := json.Unmarshal(data, &conf)
+	if err != nil {
+		return err
+	}
+
+	joinRetry, hasJoinRetry, err := parseOptionalDuration(conf.JoinRetry)
+	if err != nil {
+		return err
+	}
+	leftNodeExpire, hasLeftNodeExpire, err := parseOptionalDuration(conf.LeftNodeExpire)
+	if err != nil {
+		return err
+	}
+	if (conf.Seeds != nil || conf.MemberlistSeeds != nil) && !s.config.IsDynamicIPs {
+		err = s.updateSeedLists(func(seeds *seedLists) {
+			if conf.Seeds != nil {
+				seeds.grpcAddrs = conf.Seeds
+			}
+			if conf.MemberlistSeeds != nil {
+				seeds.memberlistAddrs = conf.MemberlistSeeds
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if hasJoinRetry {
+		s.SetJoinRetryDuration(joinRetry)
+	}
+	if hasLeftNodeExpire {
+		s.SetLeftNodeExpireTime(leftNodeExpire)
+	}
+	return nil
+}
+
+// reloadConfigFile returns the content of the file, it is only applied if different from last
+func (s *PoolServer) reloadConfigFile(last []byte) []byte {
+	data, err := ioutil.ReadFile(s.options.configFile)
+	if err != nil {
+		s.options.logger.Error("read config file", zap.Error(err))
+		return last
+	}
+	if last != nil && bytes.Equal(data, last) {
+		return last
+	}
+
+	err = s.applyConfigFile(data)
+	if err != nil {
+		s.options.logger.Error("apply config file", zap.Error(err))
+	} else {
+		s.options.logger.Info("config file reloaded", zap.String("path", s.options.configFile))
+	}
+	return data
+}
+
+// runConfigFileWatcher polls the config file for changes
+func (s *PoolServer) runConfigFileWatcher(last []byte) {
+	ticker := time.NewTicker(s.options.configPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			last = s.reloadConfigFile(last)
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package goblin
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestSeedsServer(config ServerConfig) *PoolServer {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &PoolServer{
+		config:       config,
+		options:      computeServerOptions(),
+		nodeMap:      newNodeMap(30 * time.Second),
+		joinRetry:    int64(30 * time.Second),
+		seedsChanged: make(chan struct{}),
+		ctx:          ctx,
+		cancel:       cancel,
+	}
+	s.setSeeds(nil)
+	return s
+}
+
+func TestPoolServer_UpdateSeeds(t *testing.T) {
+	s := newTestSeedsServer(ServerConfig{})
+	assert.Equal(t, []string(nil), s.getSeeds())
+
+	changed := s.seedsChangedChan()
+	seq, _ := s.nodeMap.getNodes()
+
+	err := s.UpdateSeeds([]string{"address-1:8001", "address-2:8001"})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{"address-1:10001", "address-2:10001"}, s.getSeeds())
+
+	// wakes the join loop
+	<-changed
+	newSeq, _ := s.nodeMap.watchNodes(seq)
+	assert.Equal(t, seq+1, newSeq)
+
+	err = s.UpdateSeeds([]string{"address-3"})
+	assert.Equal(t, "invalid static address", err.Error())
+	assert.Equal(t, []string{"address-1:10001", "address-2:10001"}, s.getSeeds())
+}
+
+func TestPoolServer_UpdateMemberlistSeeds(t *testing.T) {
+	s := newTestSeedsServer(ServerConfig{})
+	_ = s.UpdateSeeds([]string{"address-1:8001"})
+
+	err := s.UpdateMemberlistSeeds([]string{"address-2:7946"})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{"address-1:10001", "address-2:7946"}, s.getSeeds())
+
+	err = s.UpdateMemberlistSeeds([]string{"address-3"})
+	assert.Equal(t, "invalid static address", err.Error())
+	assert.Equal(t, []string{"address-1:10001", "address-2:7946"}, s.getSeeds())
+
+	err = s.UpdateSeeds(nil)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{"address-2:7946"}, s.getSeeds())
+
+	err = s.applyConfigFile([]byte(`{"memberlist_seeds": ["address-4:7946"]}`))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{"address-4:7946"}, s.getSeeds())
+}
+
+func TestPoolServer_UpdateSeeds_Dynamic_IPs(t *testing.T) {
+	s := newTestSeedsServer(ServerConfig{IsDynamicIPs: true})
+	err := s.UpdateSeeds([]string{"address-1:8001"})
+	assert.Equal(t, ErrSeedsNotUsed, err)
+}
+
+func TestPoolServer_SleepJoinRetry(t *testing.T) {
+	s := newTestSeedsServer(ServerConfig{})
+	changed := s.seedsChangedChan()
+
+	done := make(chan struct{})
+	go func() {
+		s.sleepJoinRetry(changed)
+		close(done)
+	}()
+
+	_ = s.UpdateSeeds(nil)
+	<-done
+
+	s.SetJoinRetryDuration(time.Millisecond)
+	assert.Equal(t, time.Millisecond, s.getJoinRetryDuration())
+	s.sleepJoinRetry(s.seedsChangedChan())
+
+	s.SetJoinRetryDuration(time.Hour)
+	s.cancel()
+	s.sleepJoinRetry(nil)
+}
+
+func TestPoolServer_ApplyConfigFile(t *testing.T) {
+	s := newTestSeedsServer(ServerConfig{})
+
+	err := s.applyConfigFile([]byte(`{"seeds": ["address-1:8001"], "join_retry": "5s", "left_node_expire": "1m"}`))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{"address-1:10001"}, s.getSeeds())
+	assert.Equal(t, 5*time.Second, s.getJoinRetryDuration())
+	assert.Equal(t, time.Minute, s.nodeMap.leftNodeTime)
+
+	// absent fields are not changed
+	err = s.applyConfigFile([]byte(`{"join_retry": "7s"}`))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{"address-1:10001"}, s.getSeeds())
+	assert.Equal(t, 7*time.Second, s.getJoinRetryDuration())
+	assert.Equal(t, time.Minute, s.nodeMap.leftNodeTime)
+
+	err = s.applyConfigFile([]byte(`{"seeds": []}`))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{}, s.getSeeds())
+}
+
+func TestPoolServer_ApplyConfigFile_Invalid(t *testing.T) {
+	s := newTestSeedsServer(ServerConfig{})
+	_ = s.UpdateSeeds([]string{"address-1:8001"})
+
+	err := s.applyConfigFile([]byte(`{"seeds": ["address-2:8001"], "join_retry": "abc"}`))
+	assert.Error(t, err)
+
+	err = s.applyConfigFile([]byte(`{"seeds": ["address-2:8001"], "left_node_expire": "-1s"}`))
+	assert.Equal(t, "duration must be positive: -1s", err.Error())
+
+	err = s.applyConfigFile([]byte(`{"seeds": ["address-2"], "join_retry": "1s"}`))
+	assert.Equal(t, "invalid static address", err.Error())
+
+	err = s.applyConfigFile([]byte(`{`))
+	assert.Error(t, err)
+
+	// nothing is applied
+	assert.Equal(t, []string{"address-1:10001"}, s.getSeeds())
+	assert.Equal(t, 30*time.Second, s.getJoinRetryDuration())
+}
+
+func TestPoolServer_ReloadConfigFile(t *testing.T) {
+	s := newTestSeedsServer(ServerConfig{})
+	s.options.configFile = filepath.Join(t.TempDir(), "goblin.json")
+
+	// file not found
+	last := s.reloadConfigFile(nil)
+	assert.Equal(t, []byte(nil), last)
+
+	err := ioutil.WriteFile(s.options.configFile, []byte(`{"seeds": ["address-1:8001"]}`), 0644)
+	assert.Equal(t, nil, err)
+
+	last = s.reloadConfigFile(last)
+	assert.Equal(t, `{"seeds": ["address-1:8001"]}`, string(last))
+	assert.Equal(t, []string{"address-1:10001"}, s.getSeeds())
+
+	// not applied again if unchanged
+	_ = s.UpdateSeeds(nil)
+	last = s.reloadConfigFile(last)
+	assert.Equal(t, []string{}, s.getSeeds())
+
+	err = ioutil.WriteFile(s.options.configFile, []byte(`{"seeds": ["address-2:8001"]}`), 0644)
+	assert.Equal(t, nil, err)
+	s.reloadConfigFile(last)
+	assert.Equal(t, []string{"address-2:10001"}, s.getSeeds())
+}
@@ -14,36 +14,24 @@ type server struct {
 
 // Watch watch the changes of membership
 func (s *server) Watch(_ *goblinpb.WatchRequest, stream goblinpb.GoblinService_WatchServer) error {
-	ctx, cancel := context.WithCancel(stream.Context())
-	defer func() {
-		cancel()
-		s.pool.nodeMap.watcherShouldLeave()
-	}()
-
-	ch := make(chan map[string]Node, 8)
-	go func() {
-		seq, nodes := s.pool.GetNodes()
-		ch <- nodes
+	err := authorize(stream.Context(), s.pool.options.watchAuthorizer)
+	if err != nil {
+		return err
+	}
 
-		for {
-			var lastNodes map[string]Node
-			seq, nodes = s.pool.WatchNodes(seq)
-			if ctx.Err() != nil {
-				return
-			}
-			if nodeMapSame(lastNodes, nodes) {
-				continue
-			}
+	return s.sendSnapshots(stream, s.pool.broadcaster)
+}
 
-			lastNodes = nodes
-			ch <- nodes
-		}
-	}()
+// sendSnapshots sends snapshots until the stream or the pool server finishes
+func (s *server) sendSnapshots(stream grpc.ServerStream, broadcaster *snapshotBroadcaster) error {
+	sub := broadcaster.subscribe()
+	defer broadcaster.unsubscribe(sub)
 
+	ctx := stream.Context()
 	for {
 		select {
-		case nodes := <-ch:
-			err := sendChanges(stream, nodes)
+		case msg := <-sub.ch:
+			err := stream.SendMsg(msg)
 			if err != nil {
 				return err
 			}
@@ -57,30 +45,38 @@ func (s *server) Watch(_ *goblinpb.WatchRequest, stream goblinpb.GoblinService_W
 	}
 }
 
-func sendChanges(stream goblinpb.GoblinService_WatchServer, nodes map[string]Node) error {
-	output := make([]*goblinpb.Node, 0, len(nodes))
-	for name, n := range nodes {
-		output = append(output, &goblinpb.Node{
-			Name: name,
-			Addr: n.Addr,
-		})
+// GetNode for dynamic ips in Kubernetes environment
+func (s *server) GetNode(ctx context.Context, _ *goblinpb.GetNodeRequest) (*goblinpb.GetNodeResponse, error) {
+	err := authorize(ctx, s.pool.options.watchAuthorizer)
+	if err != nil {
+		return nil, err
 	}
 
-	err := stream.Send(&goblinpb.NodeList{
-		Nodes: output,
-	})
+	return &goblinpb.GetNodeResponse{
+		Name:     s.pool.GetName(),
+		Addr:     s.pool.GetMemberlistAddress(),
+		GrpcAddr: s.pool.GetGRPCAddress(),
+	}, nil
+}
+
+// GetShardMap returns the current shard assignment
+func (s *server) GetShardMap(ctx context.Context, _ *goblinpb.GetShardMapRequest) (*goblinpb.ShardMap, error) {
+	err := authorize(ctx, s.pool.options.watchAuthorizer)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return nil
+
+	seq, owners := s.pool.GetShardMap()
+	return shardMapToProto(seq, owners), nil
 }
 
-// GetNode for dynamic ips in Kubernetes environment
-func (s *server) GetNode(context.Context, *goblinpb.GetNodeRequest) (*goblinpb.GetNodeResponse, error) {
-	return &goblinpb.GetNodeResponse{
-		Name: s.pool.GetName(),
-		Addr: s.pool.GetMemberlistAddress(),
-	}, nil
+// WatchShardMap watch the changes of shard assignment
+func (s *server) WatchShardMap(_ *goblinpb.WatchShardMapRequest, stream goblinpb.GoblinService_WatchShardMapServer) error {
+	err := authorize(stream.Context(), s.pool.options.watchAuthorizer)
+	if err != nil {
+		return err
+	}
+	return s.sendSnapshots(stream, s.pool.shardBroadcaster)
 }
 
 // Register to grpc server
@@ -0,0 +1,254 @@
+package goblin
+
+import (
+	"encoding/binary"
+	"github.com/QuangTung97/goblin/goblinpb"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+	"hash/fnv"
+	"math"
+	"sort"
+	"sync"
+)
+
+// shardVirtualNodes is the number of points of each node on the hash ring
+const shardVirtualNodes = 64
+
+// hash64 is FNV-1a with a finalizer for better distribution of similar inputs
+func hash64(data []byte) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write(data)
+	x := h.Sum64()
+
+	// splitmix64 finalizer
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// ShardForKey returns the shard of a key, the same function is used by servers and clients
+func ShardForKey(key string, shardCount int) int {
+	if shardCount <= 0 {
+		return 0
+	}
+	return int(hash64([]byte(key)) % uint64(shardCount))
+}
+
+type ringPoint struct {
+	hash uint64
+	node int
+}
+
+func buildHashRing(nodes []string) []ringPoint {
+	ring := make([]ringPoint, 0, len(nodes)*shardVirtualNodes)
+	var buf [8]byte
+	for i, name := range nodes {
+		for v := 0; v < shardVirtualNodes; v++ {
+			binary.BigEndian.PutUint64(buf[:], uint64(v))
+			ring = append(ring, ringPoint{
+				hash: hash64(append([]byte(name), buf[:]...)),
+				node: i,
+			})
+		}
+	}
+	sort.Slice(ring, func(i, j int) bool {
+		if ring[i].hash != ring[j].hash {
+			return ring[i].hash < ring[j].hash
+		}
+		return ring[i].node < ring[j].node
+	})
+	return ring
+}
+
+// assignShards computes the owner of each shard by consistent hashing with bounded loads:
+// each shard goes to the first node clockwise on the ring that owns less than
+// ceil(shardCount * loadFactor / len(nodes)) shards. The result only depends on the set of nodes
+func assignShards(nodes []string, shardCount int, loadFactor float64) []string {
+	if len(nodes) == 0 || shardCount <= 0 {
+		return nil
+	}
+
+	nodes = append([]string(nil), nodes...)
+	sort.Strings(nodes)
+
+	if loadFactor < 1 {
+		loadFactor = 1
+	}
+	capacity := int(math.Ceil(float64(shardCount) * loadFactor / float64(len(nodes))))
+
+	ring := buildHashRing(nodes)
+	loads := make([]int, len(nodes))
+	result := make([]string, shardCount)
+
+	var buf [8]byte
+	for shard := 0; shard < shardCount; shard++ {
+		binary.BigEndian.PutUint64(buf[:], uint64(shard))
+		h := hash64(buf[:])
+
+		index := sort.Search(len(ring), func(i int) bool {
+			return ring[i].hash >= h
+		})
+		for {
+			point := ring[index%len(ring)]
+			if loads[point.node] < capacity {
+				loads[point.node]++
+				result[shard] = nodes[point.node]
+				break
+			}
+			index++
+		}
+	}
+	return result
+}
+
+func shardMapToProto(seq uint64, owners []string) *goblinpb.ShardMap {
+	result := &goblinpb.ShardMap{
+		Seq:    seq,
+		Owners: make([]uint32, 0, len(owners)),
+	}
+
+	indices := map[string]uint32{}
+	for _, owner := range owners {
+		index, existed := indices[owner]
+		if !existed {
+			index = uint32(len(result.Nodes))
+			indices[owner] = index
+			result.Nodes = append(result.Nodes, owner)
+		}
+		result.Owners = append(result.Owners, index)
+	}
+	return result
+}
+
+// shardMapFromProto returns nil if the shard map is invalid
+func shardMapFromProto(m *goblinpb.ShardMap) []string {
+	owners := make([]string, 0, len(m.Owners))
+	for _, index := range m.Owners {
+		if int(index) >= len(m.Nodes) {
+			return nil
+		}
+		owners = append(owners, m.Nodes[index])
+	}
+	return owners
+}
+
+// shardState is the current shard assignment of PoolServer
+type shardState struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	seq    uint64
+	owners []string // owner name of each shard, immutable
+}
+
+func newShardState() *shardState {
+	s := &shardState{}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+// update returns false if the assignment does not change
+func (s *shardState) update(owners []string) (uint64, bool) {
+	s.mu.Lock()
+	if stringSliceEqual(s.owners, owners) {
+		seq := s.seq
+		s.mu.Unlock()
+		return seq, false
+	}
+	s.owners = owners
+	s.seq++
+	seq := s.seq
+	s.mu.Unlock()
+
+	s.cond.Broadcast()
+	return seq, true
+}
+
+func (s *shardState) get() (uint64, []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.seq, s.owners
+}
+
+func (s *shardState) watch(lastSeq uint64) (uint64, []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for s.seq <= lastSeq {
+		s.cond.Wait()
+	}
+	return s.seq, s.owners
+}
+
+func (s *shardState) close() {
+	s.mu.Lock()
+	s.seq++
+	s.mu.Unlock()
+
+	s.cond.Broadcast()
+}
+
+func ownedShards(owners []string, name string) []int {
+	var result []int
+	for shard, owner := range owners {
+		if owner == name {
+			result = append(result, shard)
+		}
+	}
+	return result
+}
+
+func (s *PoolServer) publishShardMap(seq uint64, owners []string) {
+	data, err := proto.Marshal(shardMapToProto(seq, owners))
+	if err != nil {
+		s.options.logger.Error("encode ShardMap", zap.Error(err))
+		return
+	}
+	s.shardBroadcaster.publish(&encodedMessage{data: data})
+}
+
+// runShardAssigner recomputes the shard assignment whenever membership changes
+func (s *PoolServer) runShardAssigner() {
+	var seq uint64
+	for {
+		var nodes map[string]Node
+		seq, nodes = s.nodeMap.watchNodes(seq)
+		if s.ctx.Err() != nil {
+			return
+		}
+
+		names := make([]string, 0, len(nodes))
+		for name := range nodes {
+			names = append(names, name)
+		}
+
+		owners := assignShards(names, s.options.shardCount, s.options.shardLoadFactor)
+		shardSeq, changed := s.shards.update(owners)
+		if changed {
+			s.publishShardMap(shardSeq, owners)
+		}
+	}
+}
+
+// GetShardMap returns the sequence number and the owner name of each shard (indexed by shard),
+// the slice must not be modified. Empty when sharding is disabled (see WithShardCount)
+func (s *PoolServer) GetShardMap() (uint64, []string) {
+	return s.shards.get()
+}
+
+// OwnedShards returns the shards owned by the current node, in increasing order.
+// Like Leader, it is computed from the local membership view, so a shard can be owned by
+// multiple nodes for a short time while membership is changing
+func (s *PoolServer) OwnedShards() []int {
+	_, owners := s.shards.get()
+	return ownedShards(owners, s.name)
+}
+
+// WatchOwnedShards blocks until the shard assignment changes from the one of lastSeq,
+// starts with lastSeq = 0. Also returns after Shutdown
+func (s *PoolServer) WatchOwnedShards(lastSeq uint64) (uint64, []int) {
+	seq, owners := s.shards.watch(lastSeq)
+	return seq, ownedShards(owners, s.name)
+}
@@ -0,0 +1,118 @@
+package goblin
+
+import (
+	"github.com/QuangTung97/goblin/goblinpb"
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func countShards(owners []string) map[string]int {
+	result := map[string]int{}
+	for _, owner := range owners {
+		result[owner]++
+	}
+	return result
+}
+
+func TestShardForKey(t *testing.T) {
+	assert.Equal(t, 0, ShardForKey("key-1", 0))
+	assert.Equal(t, ShardForKey("key-1", 16), ShardForKey("key-1", 16))
+
+	counts := make([]int, 16)
+	for i := 0; i < 1600; i++ {
+		shard := ShardForKey("key-"+strconv.Itoa(i), 16)
+		counts[shard]++
+	}
+	for _, count := range counts {
+		assert.Greater(t, count, 50)
+	}
+}
+
+func TestAssignShards(t *testing.T) {
+	assert.Equal(t, []string(nil), assignShards(nil, 16, 1.25))
+	assert.Equal(t, []string(nil), assignShards([]string{"name-1"}, 0, 1.25))
+
+	owners := assignShards([]string{"name-3", "name-1", "name-2"}, 64, 1.25)
+	assert.Equal(t, 64, len(owners))
+
+	// deterministic, not depending on the order of nodes
+	assert.Equal(t, owners, assignShards([]string{"name-1", "name-2", "name-3"}, 64, 1.25))
+
+	// bounded loads: ceil(64 * 1.25 / 3) = 27
+	counts := countShards(owners)
+	assert.Equal(t, 3, len(counts))
+	for _, count := range counts {
+		assert.LessOrEqual(t, count, 27)
+	}
+
+	// load factor less than 1 is treated as 1
+	counts = countShards(assignShards([]string{"name-1", "name-2"}, 64, 0.5))
+	assert.Equal(t, map[string]int{"name-1": 32, "name-2": 32}, counts)
+}
+
+func TestAssignShards_Minimal_Movement(t *testing.T) {
+	nodes := []string{"name-1", "name-2", "name-3", "name-4"}
+	before := assignShards(nodes, 256, 1.25)
+	after := assignShards(nodes[:3], 256, 1.25)
+
+	moved := 0
+	for shard := range before {
+		if before[shard] != "name-4" && before[shard] != after[shard] {
+			moved++
+		}
+	}
+	// only a small part of the shards of remaining nodes are moved because of the load bound
+	assert.Less(t, moved, 256/4)
+}
+
+func TestShardMapProto(t *testing.T) {
+	m := shardMapToProto(3, []string{"name-2", "name-1", "name-2"})
+	assert.Equal(t, uint64(3), m.Seq)
+	assert.Equal(t, []string{"name-2", "name-1"}, m.Nodes)
+	assert.Equal(t, []uint32{0, 1, 0}, m.Owners)
+
+	assert.Equal(t, []string{"name-2", "name-1", "name-2"}, shardMapFromProto(m))
+	assert.Equal(t, []string{}, shardMapFromProto(&goblinpb.ShardMap{}))
+	assert.Equal(t, []string(nil), shardMapFromProto(&goblinpb.ShardMap{
+		Nodes:  []string{"name-1"},
+		Owners: []uint32{1},
+	}))
+}
+
+func TestOwnedShards(t *testing.T) {
+	owners := []string{"name-1", "name-2", "name-1"}
+	assert.Equal(t, []int{0, 2}, ownedShards(owners, "name-1"))
+	assert.Equal(t, []int(nil), ownedShards(owners, "name-3"))
+}
+
+func TestShardState(t *testing.T) {
+	s := newShardState()
+
+	seq, changed := s.update([]string{"name-1"})
+	assert.Equal(t, uint64(1), seq)
+	assert.Equal(t, true, changed)
+
+	seq, changed = s.update([]string{"name-1"})
+	assert.Equal(t, uint64(1), seq)
+	assert.Equal(t, false, changed)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	var owners []string
+	go func() {
+		defer wg.Done()
+		seq, owners = s.watch(1)
+	}()
+
+	s.update([]string{"name-2"})
+	wg.Wait()
+	assert.Equal(t, uint64(2), seq)
+	assert.Equal(t, []string{"name-2"}, owners)
+
+	s.close()
+	seq, _ = s.watch(2)
+	assert.Equal(t, uint64(3), seq)
+}
@@ -0,0 +1,206 @@
+package goblin
+
+import (
+	"context"
+	"github.com/QuangTung97/goblin/goblinpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/status"
+	"sync"
+	"time"
+)
+
+// StalePolicy is the action of PoolClient when the membership view is older than the staleness TTL
+type StalePolicy int
+
+const (
+	// StalePolicyKeep keeps all connections, only reports metrics
+	StalePolicyKeep StalePolicy = iota
+
+	// StalePolicyProbe probes nodes directly with the GetNode RPC and removes the unreachable ones
+	StalePolicyProbe
+
+	// StalePolicyDrop pessimistically removes nodes whose connections are in TRANSIENT_FAILURE
+	StalePolicyDrop
+)
+
+// minStalenessTTL the staleness is checked every ttl / 2
+const minStalenessTTL = 10 * time.Millisecond
+
+// Staleness returns zero when a Watch stream is connected, otherwise returns
+// the duration since the membership view was last known up to date
+func (c *PoolClient) Staleness() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.activeSourceLocked() >= 0 {
+		return 0
+	}
+	return c.getNow().Sub(c.lastSync)
+}
+
+func (c *PoolClient) checkStaleLoop() {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(c.options.stalenessTTL / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.checkStale()
+		case <-c.ctx.Done():
+			return
+		}
+	}
+}
+
+func (c *PoolClient) checkStale() {
+	staleness := c.Staleness()
+	c.options.metrics.MembershipStaleness(staleness)
+	if staleness <= c.options.stalenessTTL {
+		return
+	}
+
+	var unreachable []string
+	switch c.options.stalePolicy {
+	case StalePolicyProbe:
+		unreachable = c.probeNodes(c.options.stalenessTTL / 2)
+	case StalePolicyDrop:
+		unreachable = findFailedNodes(c.getClientConns())
+	default:
+		return
+	}
+	c.removeStaleNodes(unreachable)
+}
+
+func findFailedNodes(conns *clientConns) []string {
+	if conns == nil {
+		return nil
+	}
+
+	var result []string
+	for _, conn := range conns.conns {
+		cc := conn.getConn()
+		if cc != nil && cc.GetState() == connectivity.TransientFailure {
+			result = append(result, conn.nodeName)
+		}
+	}
+	return result
+}
+
+func (c *PoolClient) probeNodes(timeout time.Duration) []string {
+	conns := c.getClientConns()
+	if conns == nil {
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var result []string
+
+	for _, conn := range conns.conns {
+		if !conn.acquire() {
+			continue
+		}
+
+		wg.Add(1)
+		go func(conn *clientConn) {
+			defer wg.Done()
+			defer releaseAndClose(conn)
+
+			cc, err := conn.connect()
+			if err == nil {
+				err = probeNode(cc, timeout)
+			}
+			c.options.metrics.StaleProbe(conn.nodeName, err)
+			if err == nil {
+				return
+			}
+
+			mu.Lock()
+			result = append(result, conn.nodeName)
+			mu.Unlock()
+		}(conn)
+	}
+
+	wg.Wait()
+	return result
+}
+
+// probeNode returns an error only if the node is unreachable, other errors (e.g. PermissionDenied) are ignored
+func probeNode(conn grpc.ClientConnInterface, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	_, err := goblinpb.NewGoblinServiceClient(conn).GetNode(ctx, &goblinpb.GetNodeRequest{})
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return err
+	default:
+		return nil
+	}
+}
+
+func (c *PoolClient) removeStaleNodes(names []string) {
+	if len(names) == 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// membership has been up to date again
+	if c.activeSourceLocked() >= 0 {
+		return
+	}
+
+	nameSet := map[string]struct{}{}
+	for _, name := range names {
+		nameSet[name] = struct{}{}
+	}
+
+	newConns, removed := removeClientConns(c.getClientConns(), nameSet, c.options.drainTimeout)
+	c.setClientConns(newConns)
+	c.lastNodes = removeNodesByName(c.lastNodes, nameSet) // not added back by the quarantine retry
+	for _, name := range removed {
+		c.options.metrics.StaleDrop(name)
+	}
+}
+
+func removeNodesByName(nodes []*goblinpb.Node, names map[string]struct{}) []*goblinpb.Node {
+	result := make([]*goblinpb.Node, 0, len(nodes))
+	for _, node := range nodes {
+		if _, existed := names[node.Name]; !existed {
+			result = append(result, node)
+		}
+	}
+	return result
+}
+
+func removeClientConns(
+	old *clientConns, names map[string]struct{}, drainTimeout time.Duration,
+) (*clientConns, []string) {
+	if old == nil {
+		return nil, nil
+	}
+
+	var removed []string
+	removedSet := map[string]struct{}{}
+	result := &clientConns{}
+	result.conns = make([]*clientConn, 0, len(old.conns))
+	for _, conn := range old.conns {
+		_, existed := names[conn.nodeName]
+		if existed {
+			if _, ok := removedSet[conn.nodeName]; !ok {
+				removedSet[conn.nodeName] = struct{}{}
+				removed = append(removed, conn.nodeName)
+			}
+			removeClientConn(conn, drainTimeout)
+			continue
+		}
+		result.conns = append(result.conns, conn)
+	}
+	return result, removed
+}
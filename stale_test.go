@@ -0,0 +1,192 @@
+package goblin
+
+import (
+	"github.com/QuangTung97/goblin/goblinpb"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+type staleMetricsRecorder struct {
+	NopClientMetrics
+
+	mu         sync.Mutex
+	staleness  []time.Duration
+	probed     []string
+	dropped    []string
+	probeFails int
+}
+
+func (m *staleMetricsRecorder) MembershipStaleness(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.staleness = append(m.staleness, d)
+}
+
+func (m *staleMetricsRecorder) StaleProbe(nodeName string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.probed = append(m.probed, nodeName)
+	if err != nil {
+		m.probeFails++
+	}
+}
+
+func (m *staleMetricsRecorder) StaleDrop(nodeName string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.dropped = append(m.dropped, nodeName)
+}
+
+// getClosedPortAddr returns a memberlist address whose gRPC port refuses connections
+func getClosedPortAddr(t *testing.T, portDiff int) string {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Equal(t, nil, err)
+	port := lis.Addr().(*net.TCPAddr).Port
+	_ = lis.Close()
+	return net.JoinHostPort("127.0.0.1", strconv.Itoa(port+portDiff))
+}
+
+func TestPoolClient_Staleness(t *testing.T) {
+	pool := newTestWatchPoolClient(1)
+
+	now1 := mustParse("2021-06-18T09:00:00+07:00")
+	pool.lastSync = now1
+	pool.getNow = func() time.Time { return now1.Add(5 * time.Second) }
+	assert.Equal(t, 5*time.Second, pool.Staleness())
+
+	pool.handleNewNodeList(0, &goblinpb.NodeList{
+		Seq:   1,
+		Nodes: []*goblinpb.Node{{Name: "name-1", Addr: "127.0.0.1:5800"}},
+	})
+	assert.Equal(t, time.Duration(0), pool.Staleness())
+
+	now2 := now1.Add(20 * time.Second)
+	pool.getNow = func() time.Time { return now2 }
+	pool.sourceDisconnected(0)
+
+	pool.getNow = func() time.Time { return now2.Add(3 * time.Second) }
+	assert.Equal(t, 3*time.Second, pool.Staleness())
+}
+
+func TestRemoveClientConns(t *testing.T) {
+	conn1 := &clientConn{nodeName: "name-1", refCount: 2}
+	conn2 := &clientConn{nodeName: "name-2", refCount: 3}
+
+	result, removed := removeClientConns(&clientConns{
+		conns: []*clientConn{conn1, conn2},
+	}, map[string]struct{}{"name-2": {}}, 0)
+
+	assert.Equal(t, []*clientConn{conn1}, result.conns)
+	assert.Equal(t, []string{"name-2"}, removed)
+	assert.Equal(t, uint64(2), conn2.refCount)
+
+	conn3 := &clientConn{nodeName: "name-3", refCount: 1}
+	conn4 := &clientConn{nodeName: "name-3", refCount: 1}
+	result, removed = removeClientConns(&clientConns{
+		conns: []*clientConn{conn1, conn3, conn4},
+	}, map[string]struct{}{"name-3": {}}, 0)
+	assert.Equal(t, []*clientConn{conn1}, result.conns)
+	assert.Equal(t, []string{"name-3"}, removed)
+
+	result, removed = removeClientConns(nil, map[string]struct{}{"name-2": {}}, 0)
+	assert.Equal(t, (*clientConns)(nil), result)
+	assert.Equal(t, []string(nil), removed)
+}
+
+func TestPoolClient_CheckStale_Probe(t *testing.T) {
+	metrics := &staleMetricsRecorder{}
+	pool := makePoolClient(ClientConfig{
+		Options: newTestWatchPoolClient(1).config.Options,
+	}, WithClientPortDiff(200), WithStalenessTTL(time.Second),
+		WithStalePolicy(StalePolicyProbe), WithClientMetrics(metrics))
+
+	pool.handleNewNodeList(0, &goblinpb.NodeList{
+		Seq:   1,
+		Nodes: []*goblinpb.Node{{Name: "name-1", Addr: getClosedPortAddr(t, 200)}},
+	})
+	pool.sourceDisconnected(0)
+
+	// not stale yet
+	pool.checkStale()
+	assert.Equal(t, []string{"name-1"}, getConnNodeNames(pool))
+
+	now := time.Now().Add(2 * time.Second)
+	pool.getNow = func() time.Time { return now }
+	pool.checkStale()
+
+	assert.Equal(t, []string(nil), getConnNodeNames(pool))
+	assert.Equal(t, []string{"name-1"}, metrics.probed)
+	assert.Equal(t, 1, metrics.probeFails)
+	assert.Equal(t, []string{"name-1"}, metrics.dropped)
+	assert.Equal(t, 2, len(metrics.staleness))
+}
+
+func TestPoolClient_CheckStale_Keep(t *testing.T) {
+	metrics := &staleMetricsRecorder{}
+	pool := makePoolClient(ClientConfig{
+		Options: newTestWatchPoolClient(1).config.Options,
+	}, WithClientPortDiff(200), WithStalenessTTL(time.Second), WithClientMetrics(metrics))
+
+	pool.handleNewNodeList(0, &goblinpb.NodeList{
+		Seq:   1,
+		Nodes: []*goblinpb.Node{{Name: "name-1", Addr: getClosedPortAddr(t, 200)}},
+	})
+	pool.sourceDisconnected(0)
+
+	now := time.Now().Add(2 * time.Second)
+	pool.getNow = func() time.Time { return now }
+	pool.checkStale()
+
+	assert.Equal(t, []string{"name-1"}, getConnNodeNames(pool))
+	assert.Equal(t, []string(nil), metrics.dropped)
+}
+
+func TestPoolClient_CheckStale_Drop(t *testing.T) {
+	metrics := &staleMetricsRecorder{}
+	pool := makePoolClient(ClientConfig{
+		Options: newTestWatchPoolClient(1).config.Options,
+	}, WithClientPortDiff(200), WithStalenessTTL(time.Second),
+		WithStalePolicy(StalePolicyDrop), WithClientMetrics(metrics))
+
+	pool.handleNewNodeList(0, &goblinpb.NodeList{
+		Seq: 1,
+		Nodes: []*goblinpb.Node{
+			{Name: "name-1", Addr: getClosedPortAddr(t, 200)},
+			{Name: "name-2", Addr: "some-host-2"},
+		},
+	})
+	pool.sourceDisconnected(0)
+
+	assert.Eventually(t, func() bool {
+		return len(findFailedNodes(pool.getClientConns())) == 1
+	}, 5*time.Second, 5*time.Millisecond)
+
+	now := time.Now().Add(2 * time.Second)
+	pool.getNow = func() time.Time { return now }
+	pool.checkStale()
+
+	assert.Equal(t, []string(nil), getConnNodeNames(pool))
+	assert.Equal(t, []string{"name-1"}, metrics.dropped)
+
+	// the quarantine retry of name-2 does not add name-1 back
+	pool.mu.Lock()
+	assert.Equal(t, []*goblinpb.Node{{Name: "name-2", Addr: "some-host-2"}}, pool.lastNodes)
+	pool.updateClientConnsLocked(pool.lastNodes)
+	pool.mu.Unlock()
+	assert.Equal(t, []string(nil), getConnNodeNames(pool))
+}
+
+func TestWithStalenessTTL_Minimum(t *testing.T) {
+	opts := computeClientOptions(WithStalenessTTL(time.Nanosecond))
+	assert.Equal(t, minStalenessTTL, opts.stalenessTTL)
+
+	opts = computeClientOptions(WithStalenessTTL(time.Second))
+	assert.Equal(t, time.Second, opts.stalenessTTL)
+
+	opts = computeClientOptions()
+	assert.Equal(t, time.Duration(0), opts.stalenessTTL)
+}
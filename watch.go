@@ -0,0 +1,278 @@
+package goblin
+
+import (
+	"github.com/QuangTung97/goblin/goblinpb"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"io"
+	"math/rand"
+	"time"
+)
+
+// backoff computes exponential retry durations with jitter
+type backoff struct {
+	min     time.Duration
+	max     time.Duration
+	current time.Duration
+	random  func() float64 // returns a number in [0, 1)
+}
+
+func newBackoff(min, max time.Duration) *backoff {
+	if max < min {
+		max = min
+	}
+	return &backoff{
+		min:     min,
+		max:     max,
+		current: min,
+		random:  rand.Float64,
+	}
+}
+
+// next returns a random duration in [current / 2, current) and doubles current (up to max)
+func (b *backoff) next() time.Duration {
+	half := b.current / 2
+	result := half + time.Duration(b.random()*float64(b.current-half))
+
+	b.current *= 2
+	if b.current > b.max {
+		b.current = b.max
+	}
+	return result
+}
+
+func (b *backoff) reset() {
+	b.current = b.min
+}
+
+// watchSourceState is the state of a watch source, protected by PoolClient.mu
+type watchSourceState struct {
+	index     int
+	addr      string
+	connected bool
+	lastSeq   uint64
+	nodes     []*goblinpb.Node
+}
+
+// computeWatchAddresses returns the addresses learned from membership first, then the bootstrap addresses
+func computeWatchAddresses(members []string, bootstrap []string) []string {
+	existed := map[string]struct{}{}
+	result := make([]string, 0, len(members)+len(bootstrap))
+
+	for _, list := range [][]string{members, bootstrap} {
+		for _, addr := range list {
+			if _, ok := existed[addr]; ok {
+				continue
+			}
+			existed[addr] = struct{}{}
+			result = append(result, addr)
+		}
+	}
+	return result
+}
+
+// nextWatchAddress rotates through the watch addresses, skipping the ones used by other sources
+func (c *PoolClient) nextWatchAddress(source int) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	candidates := computeWatchAddresses(c.members, c.config.Addresses)
+	if len(candidates) == 0 {
+		return ""
+	}
+
+	state := &c.sources[source]
+	chosen := state.index % len(candidates)
+	for i := 0; i < len(candidates); i++ {
+		index := (state.index + i) % len(candidates)
+		if !c.watchAddressInUseLocked(candidates[index], source) {
+			chosen = index
+			break
+		}
+	}
+
+	state.index = chosen + 1
+	state.addr = candidates[chosen]
+	return state.addr
+}
+
+func (c *PoolClient) watchAddressInUseLocked(addr string, source int) bool {
+	for i, s := range c.sources {
+		if i != source && s.addr == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// activeSourceLocked returns the lowest connected source, updates from other sources are kept as standby
+func (c *PoolClient) activeSourceLocked() int {
+	for i, s := range c.sources {
+		if s.connected {
+			return i
+		}
+	}
+	return -1
+}
+
+// handleNewNodeList duplicates and out of order lists are discarded per source. Seqs of different sources
+// are not comparable (each server numbers its own snapshots), and only the list of the active source is applied
+func (c *PoolClient) handleNewNodeList(source int, nodeList *goblinpb.NodeList) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	state := &c.sources[source]
+	if state.connected && nodeList.Seq != 0 && nodeList.Seq <= state.lastSeq {
+		return
+	}
+
+	state.connected = true
+	state.lastSeq = nodeList.Seq
+	c.lastSync = c.getNow()
+	state.nodes = nodeList.Nodes
+
+	if c.activeSourceLocked() != source {
+		return
+	}
+	c.applyNodeListLocked(nodeList.Nodes)
+}
+
+// sourceDisconnected fails over to the next connected source (if any)
+func (c *PoolClient) sourceDisconnected(source int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	wasActive := c.activeSourceLocked() == source
+	if c.sources[source].connected {
+		c.lastSync = c.getNow()
+	}
+	c.sources[source] = watchSourceState{
+		index: c.sources[source].index,
+	}
+	if !wasActive {
+		return
+	}
+
+	active := c.activeSourceLocked()
+	if active < 0 {
+		return
+	}
+	c.applyNodeListLocked(c.sources[active].nodes)
+}
+
+func (c *PoolClient) applyNodeListLocked(nodes []*goblinpb.Node) {
+	c.updateClientConnsLocked(nodes)
+	c.updateMembersLocked(nodes)
+}
+
+// updateMembersLocked remembers the last known non-empty membership for reconnecting Watch streams
+func (c *PoolClient) updateMembersLocked(nodes []*goblinpb.Node) {
+	members := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		addr, err := nodeGRPCAddr(node, int(c.options.portDiff))
+		if err != nil {
+			continue
+		}
+		members = append(members, addr)
+	}
+	if len(members) == 0 || stringSliceEqual(members, c.members) {
+		return
+	}
+	c.members = members
+
+	if c.options.memberCacheFile == "" {
+		return
+	}
+	err := saveMemberCache(c.options.memberCacheFile, members)
+	if err != nil {
+		c.options.logger.Error("saveMemberCache", zap.Error(err))
+	}
+}
+
+func stringSliceEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// watchNodesSingleLoop returns true if it received at least one node list. Dialing is canceled
+// on Close, in case of blocking dial options
+func (c *PoolClient) watchNodesSingleLoop(source int, addr string) bool {
+	logger := c.options.logger
+
+	conn, err := grpc.DialContext(c.ctx, addr, c.config.Options...)
+	if err != nil {
+		logger.Error("dial for watch nodes", zap.Error(err))
+		return false
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	client := goblinpb.NewGoblinServiceClient(conn)
+	stream, err := client.Watch(c.ctx, &goblinpb.WatchRequest{})
+	if err != nil {
+		logger.Error("watch nodes", zap.Error(err))
+		return false
+	}
+
+	received := false
+	for {
+		nodeList, err := stream.Recv()
+		if err == io.EOF {
+			return received
+		}
+		if err != nil {
+			if c.ctx.Err() == nil {
+				logger.Error("receive nodes", zap.String("addr", addr), zap.Error(err))
+			}
+			return received
+		}
+
+		received = true
+		c.handleNewNodeList(source, nodeList)
+	}
+}
+
+// minHealthyWatchTime is the duration a watch stream must last to reset the backoff, so that servers
+// dropping streams right after the first node list are not reconnected in a tight loop
+const minHealthyWatchTime = 10 * time.Second
+
+func (c *PoolClient) watchNodes(source int) {
+	defer c.wg.Done()
+
+	b := newBackoff(c.options.watchRetryMin, c.options.watchRetry)
+	for c.ctx.Err() == nil {
+		addr := c.nextWatchAddress(source)
+		if addr == "" {
+			c.sleep(b.next())
+			continue
+		}
+
+		start := time.Now()
+		received := c.watchNodesSingleLoop(source, addr)
+		c.sourceDisconnected(source)
+
+		if received && time.Since(start) >= minHealthyWatchTime {
+			b.reset()
+		}
+		c.sleep(b.next())
+	}
+}
+
+// sleep returns early when the client is closed
+func (c *PoolClient) sleep(d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-c.ctx.Done():
+	}
+}
@@ -0,0 +1,213 @@
+package goblin
+
+import (
+	"github.com/QuangTung97/goblin/goblinpb"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"net"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	b := newBackoff(100*time.Millisecond, 500*time.Millisecond)
+	b.random = func() float64 { return 0.5 }
+
+	assert.Equal(t, 75*time.Millisecond, b.next())
+	assert.Equal(t, 150*time.Millisecond, b.next())
+	assert.Equal(t, 300*time.Millisecond, b.next())
+	assert.Equal(t, 375*time.Millisecond, b.next())
+	assert.Equal(t, 375*time.Millisecond, b.next())
+
+	b.reset()
+	assert.Equal(t, 75*time.Millisecond, b.next())
+}
+
+func TestComputeWatchAddresses(t *testing.T) {
+	result := computeWatchAddresses([]string{"address-1", "address-2"}, []string{"address-2", "address-3"})
+	assert.Equal(t, []string{"address-1", "address-2", "address-3"}, result)
+
+	result = computeWatchAddresses(nil, []string{"address-3"})
+	assert.Equal(t, []string{"address-3"}, result)
+}
+
+func TestPoolClient_NextWatchAddress(t *testing.T) {
+	pool := makePoolClient(ClientConfig{
+		Addresses: []string{"address-1", "address-2", "address-3"},
+	}, WithWatchSources(2))
+
+	assert.Equal(t, "address-1", pool.nextWatchAddress(0))
+	assert.Equal(t, "address-2", pool.nextWatchAddress(1))
+	assert.Equal(t, "address-3", pool.nextWatchAddress(0))
+	assert.Equal(t, "address-1", pool.nextWatchAddress(1))
+
+	pool.sourceDisconnected(0)
+	assert.Equal(t, "address-2", pool.nextWatchAddress(0))
+}
+
+func TestPoolClient_NextWatchAddress_Empty(t *testing.T) {
+	pool := makePoolClient(ClientConfig{})
+	assert.Equal(t, "", pool.nextWatchAddress(0))
+}
+
+func newTestWatchPoolClient(sources int) *PoolClient {
+	return makePoolClient(ClientConfig{
+		Options: []grpc.DialOption{grpc.WithInsecure()},
+	}, WithWatchSources(sources), WithClientPortDiff(200))
+}
+
+func getConnNodeNames(pool *PoolClient) []string {
+	var result []string
+	for _, conn := range pool.getClientConns().conns {
+		result = append(result, conn.nodeName)
+	}
+	return result
+}
+
+func TestPoolClient_HandleNewNodeList_Skip_Old_Seq(t *testing.T) {
+	pool := newTestWatchPoolClient(1)
+
+	pool.handleNewNodeList(0, &goblinpb.NodeList{
+		Seq:   5,
+		Nodes: []*goblinpb.Node{{Name: "name-1", Addr: "127.0.0.1:5800"}},
+	})
+	assert.Equal(t, []string{"name-1"}, getConnNodeNames(pool))
+
+	pool.handleNewNodeList(0, &goblinpb.NodeList{
+		Seq:   5,
+		Nodes: []*goblinpb.Node{{Name: "name-2", Addr: "127.0.0.1:5801"}},
+	})
+	assert.Equal(t, []string{"name-1"}, getConnNodeNames(pool))
+
+	pool.handleNewNodeList(0, &goblinpb.NodeList{
+		Seq:   6,
+		Nodes: []*goblinpb.Node{{Name: "name-2", Addr: "127.0.0.1:5801"}},
+	})
+	assert.Equal(t, []string{"name-2"}, getConnNodeNames(pool))
+}
+
+func TestPoolClient_HandleNewNodeList_Standby_Failover(t *testing.T) {
+	pool := newTestWatchPoolClient(2)
+
+	pool.handleNewNodeList(1, &goblinpb.NodeList{
+		Seq:   3,
+		Nodes: []*goblinpb.Node{{Name: "name-1", Addr: "127.0.0.1:5800"}},
+	})
+	assert.Equal(t, []string{"name-1"}, getConnNodeNames(pool))
+
+	pool.handleNewNodeList(0, &goblinpb.NodeList{
+		Seq:   10,
+		Nodes: []*goblinpb.Node{{Name: "name-2", Addr: "127.0.0.1:5801"}},
+	})
+	assert.Equal(t, []string{"name-2"}, getConnNodeNames(pool))
+
+	// standby source does not apply
+	pool.handleNewNodeList(1, &goblinpb.NodeList{
+		Seq:   4,
+		Nodes: []*goblinpb.Node{{Name: "name-3", Addr: "127.0.0.1:5802"}},
+	})
+	assert.Equal(t, []string{"name-2"}, getConnNodeNames(pool))
+
+	pool.sourceDisconnected(0)
+	assert.Equal(t, []string{"name-3"}, getConnNodeNames(pool))
+
+	pool.sourceDisconnected(1)
+	assert.Equal(t, []string{"name-3"}, getConnNodeNames(pool))
+}
+
+func TestPoolClient_HandleNewNodeList_Update_Members(t *testing.T) {
+	pool := newTestWatchPoolClient(1)
+
+	pool.handleNewNodeList(0, &goblinpb.NodeList{
+		Seq: 1,
+		Nodes: []*goblinpb.Node{
+			{Name: "name-1", Addr: "127.0.0.1:5800"},
+			{Name: "name-2", Addr: "127.0.0.1:5801"},
+		},
+	})
+	assert.Equal(t, []string{"127.0.0.1:5600", "127.0.0.1:5601"}, pool.members)
+
+	// keep the last known members when membership is empty
+	pool.handleNewNodeList(0, &goblinpb.NodeList{Seq: 2})
+	assert.Equal(t, []string{"127.0.0.1:5600", "127.0.0.1:5601"}, pool.members)
+
+	assert.Equal(t, "127.0.0.1:5600", pool.nextWatchAddress(0))
+}
+
+func TestPoolClient_Member_Cache_File(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "members.json")
+
+	pool := makePoolClient(ClientConfig{
+		Options: []grpc.DialOption{grpc.WithInsecure()},
+	}, WithClientPortDiff(200), WithMemberCacheFile(path))
+	assert.Equal(t, []string(nil), pool.members)
+
+	pool.handleNewNodeList(0, &goblinpb.NodeList{
+		Seq:   1,
+		Nodes: []*goblinpb.Node{{Name: "name-1", Addr: "127.0.0.1:5800"}},
+	})
+
+	restarted := makePoolClient(ClientConfig{
+		Addresses: []string{"127.0.0.1:4000"},
+	}, WithMemberCacheFile(path))
+	assert.Equal(t, []string{"127.0.0.1:5600"}, restarted.members)
+	assert.Equal(t, "127.0.0.1:5600", restarted.nextWatchAddress(0))
+	assert.Equal(t, "127.0.0.1:4000", restarted.nextWatchAddress(0))
+}
+
+func TestPoolClient_Close_Blocking_Dial(t *testing.T) {
+	client := NewPoolClient(ClientConfig{
+		Addresses: []string{"127.0.0.1:1"},
+		Options:   []grpc.DialOption{grpc.WithInsecure(), grpc.WithBlock()},
+	})
+	time.Sleep(20 * time.Millisecond)
+
+	closed := make(chan struct{})
+	go func() {
+		_ = client.Close()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close blocked by dialing")
+	}
+}
+
+type countingWatchServer struct {
+	fakeGoblinServer
+	watchCount int32
+}
+
+func (s *countingWatchServer) Watch(req *goblinpb.WatchRequest, stream goblinpb.GoblinService_WatchServer) error {
+	atomic.AddInt32(&s.watchCount, 1)
+	return s.fakeGoblinServer.Watch(req, stream)
+}
+
+func TestPoolClient_WatchNodes_Backoff_After_Dropped_Stream(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Equal(t, nil, err)
+
+	server := &countingWatchServer{}
+	s := grpc.NewServer()
+	goblinpb.RegisterGoblinServiceServer(s, server)
+	go func() {
+		_ = s.Serve(lis)
+	}()
+	defer s.Stop()
+
+	client := NewPoolClient(ClientConfig{
+		Addresses: []string{lis.Addr().String()},
+		Options:   []grpc.DialOption{grpc.WithInsecure()},
+	}, WithWatchBackoff(40*time.Millisecond, time.Second))
+	time.Sleep(200 * time.Millisecond)
+	_ = client.Close()
+
+	// the server drops every stream after one node list: 20ms, 40ms, 80ms... between reconnects
+	count := atomic.LoadInt32(&server.watchCount)
+	assert.True(t, count >= 2, count)
+	assert.True(t, count <= 6, count)
+}